@@ -1,9 +1,13 @@
 package extension
 
 import (
-	"log"
+	"errors"
+	"fmt"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/plugins"
 	"gopkg.in/yaml.v2"
@@ -11,64 +15,392 @@ import (
 
 // Constants definition
 const (
-	Parameters = "parameters"
-	Dynamodb   = "dynamodb"
+	Parameters               = "parameters"
 	FileName                 = "/var/task/cache.yaml"
 	InitializeCacheOnStartup = "CACHE_EXTENSION_INIT_STARTUP"
 )
 
-// Struct for storing CacheConfiguration
-type CacheConfig struct {
-	DynamoDb []plugins.DynamoDbConfiguration
+// Struct for storing CacheConfiguration, each section configures the source registered under its name
+// except the server section
+type CacheConfig map[string]interface{}
+
+// Section of the cache config file configuring the local servers instead of a cache source
+const ServerSection = "server"
+
+// Struct to store the addresses of the local servers, "host:port" or "unix:<path>"
+type ServerConfiguration struct {
+	ListenAddress string `yaml:"listenAddress"`
+	GrpcAddress   string `yaml:"grpcAddress"`
+	RespAddress   string `yaml:"respAddress"`
+	// Names each source may be read with, keyed by cache type. Sources without allowlist may be read entirely
+	Allow map[string][]string `yaml:"allow"`
 }
 
-var cacheConfig = CacheConfig{}
+var (
+	cacheConfig  = CacheConfig{}
+	serverConfig ServerConfiguration
+)
 
-// Initialize cache and start the background process to refresh cache
-func InitCacheExtensions() {
-	// Read the cache config file
+// Warmup of a source and of its groups, e.g. the tables of Dynamodb
+type SourceWarmup struct {
+	State plugins.WarmState
+	// Error of the preload, if it failed
+	Error  string
+	Groups map[string]plugins.WarmStatus
+}
+
+var (
+	// Warmup states of the sources set up by InitCache and PreloadCache
+	warmupStates = make(map[string]SourceWarmup)
+	warmupMu     sync.Mutex
+)
+
+// Returned when a lookup names a cache type no source is registered for
+var ErrUnknownCacheType = errors.New("unknown cache type")
+
+// Returned when a query names a source which cannot return several entries at once
+var ErrQueryNotSupported = errors.New("queries are not supported")
+
+// Returned when the allowlist of a source does not permit reading a name
+var ErrNotAllowed = errors.New("not allowed")
+
+// Read and parse the cache config file
+func LoadCacheConfig() {
 	data := LoadConfigFile()
 
 	// Unmarshal the configuration to struct
 	err := yaml.Unmarshal([]byte(data), &cacheConfig)
 	if err != nil {
-		log.Fatalf(plugins.PrintPrefix, "error: %v", err)
+		panic(plugins.PrintPrefix + "Error while parsing " + FileName + ": " + err.Error())
 	}
+	serverConfig = readServerConfiguration()
+}
 
+// Return the server section of the cache config file
+func GetServerConfiguration() ServerConfiguration {
+	return serverConfig
+}
+
+// Parse the server section of the cache config file
+func readServerConfiguration() ServerConfiguration {
+	var config ServerConfiguration
+	section, err := yaml.Marshal(cacheConfig[ServerSection])
+	if err == nil {
+		err = yaml.Unmarshal(section, &config)
+	}
+	if err != nil {
+		panic(plugins.PrintPrefix + "Error while reading " + ServerSection + " configuration: " + err.Error())
+	}
+	return config
+}
+
+// Initialize cache from the loaded config file, its data is loaded by PreloadCacheExtensions
+func InitCacheExtensions() {
 	// Initialize Cache
 	println(plugins.PrintPrefix, "Initializing cache ...")
 	InitCache()
+	println(plugins.PrintPrefix, "Cache successfully initialized")
+}
+
+// Load the data of the initialized cache if "CACHE_EXTENSION_INIT_STARTUP" = true
+func PreloadCacheExtensions() {
+	if !preloadOnStartup() {
+		return
+	}
+	println(plugins.PrintPrefix, "Loading cache ...")
+	PreloadCache()
 	println(plugins.PrintPrefix, "Cache successfully loaded")
 }
 
-// Initialize individual cache
+// Initialize individual cache. Sources are loaded lazily unless they are preloaded afterwards
 func InitCache() {
+	preload := preloadOnStartup()
 
-	// Read Lambda env variable
-	var initCache = os.Getenv(InitializeCacheOnStartup)
-	var initCacheInBool = false
-	if initCache != "" {
-		cacheInBool, err := strconv.ParseBool(initCache)
+	// Initialize every configured source
+	for _, cacheType := range configuredSources() {
+		source, ok := plugins.GetSource(cacheType)
+		if !ok {
+			panic(plugins.PrintPrefix + "Unknown cache type '" + cacheType + "' in " + FileName)
+		}
+		setWarmup(cacheType, plugins.WarmLoading, nil)
+
+		section, err := yaml.Marshal(cacheConfig[cacheType])
 		if err != nil {
-			panic(plugins.PrintPrefix + "Error while converting CACHE_EXTENSION_INIT_STARTUP env variable " +
-				initCache)
-		} else {
-			initCacheInBool = cacheInBool
+			panic(plugins.PrintPrefix + "Error while reading " + cacheType + " configuration: " + err.Error())
+		}
+		err = source.Init(func(config interface{}) error {
+			return yaml.Unmarshal(section, config)
+		})
+		if err != nil {
+			panic(plugins.PrintPrefix + "Error while initializing " + cacheType + " cache: " + err.Error())
+		}
+
+		if !preload {
+			if warmupSource, ok := source.(plugins.WarmupSource); ok {
+				warmupSource.SkipWarmup()
+			}
+			setWarmup(cacheType, plugins.WarmLazy, nil)
 		}
 	}
+}
 
-	// Initialize map and load data from individual services if "CACHE_EXTENSION_INIT_STARTUP" = true
-	plugins.InitDynamodb(cacheConfig.DynamoDb, initCacheInBool)
+// Load the data of every initialized source
+func PreloadCache() {
+	for _, cacheType := range configuredSources() {
+		source, _ := plugins.GetSource(cacheType)
+		if err := source.Preload(); err != nil {
+			println(plugins.PrintPrefix, "Error while loading "+cacheType+" cache:", err.Error())
+			setWarmup(cacheType, plugins.WarmFailed, err)
+			continue
+		}
+		setWarmup(cacheType, plugins.WarmReady, nil)
+	}
 }
 
-// Route request to corresponding cache handlers
-func RouteCache(cacheType string, name string) string {
+// Read the Lambda env variable "CACHE_EXTENSION_INIT_STARTUP"
+func preloadOnStartup() bool {
+	var initCache = os.Getenv(InitializeCacheOnStartup)
+	if initCache == "" {
+		return false
+	}
+	cacheInBool, err := strconv.ParseBool(initCache)
+	if err != nil {
+		panic(plugins.PrintPrefix + "Error while converting CACHE_EXTENSION_INIT_STARTUP env variable " +
+			initCache)
+	}
+	return cacheInBool
+}
+
+// Record the warmup state of a source
+func setWarmup(cacheType string, state plugins.WarmState, err error) {
+	warmupMu.Lock()
+	defer warmupMu.Unlock()
+	warmup := SourceWarmup{State: state}
+	if err != nil {
+		warmup.Error = err.Error()
+	}
+	warmupStates[cacheType] = warmup
+}
+
+// Report the warmup of every configured source. The cache is ready once every source and group
+// finished loading without error, or is loaded lazily
+func Readiness() (bool, map[string]SourceWarmup) {
+	ready := true
+	sources := make(map[string]SourceWarmup)
+	for _, cacheType := range configuredSources() {
+		warmupMu.Lock()
+		warmup, ok := warmupStates[cacheType]
+		warmupMu.Unlock()
+		if !ok {
+			warmup.State = plugins.WarmPending
+		}
+
+		source, _ := plugins.GetSource(cacheType)
+		if warmupSource, ok := source.(plugins.WarmupSource); ok && warmup.State != plugins.WarmPending {
+			warmup.Groups = warmupSource.Warmup()
+		}
+
+		ready = ready && warmed(warmup.State)
+		for _, group := range warmup.Groups {
+			ready = ready && warmed(group.State)
+		}
+		sources[cacheType] = warmup
+	}
+	return ready, sources
+}
+
+// Check whether a state lets lookups be served from the cache
+func warmed(state plugins.WarmState) bool {
+	return state == plugins.WarmReady || state == plugins.WarmLazy
+}
+
+// Return the cache types configured in cache.yaml in alphabetical order
+func configuredSources() []string {
+	cacheTypes := make([]string, 0, len(cacheConfig))
+	for cacheType := range cacheConfig {
+		if cacheType == ServerSection {
+			continue
+		}
+		cacheTypes = append(cacheTypes, cacheType)
+	}
+	sort.Strings(cacheTypes)
+	return cacheTypes
+}
+
+// Check whether the allowlist of a source permits reading a name. Patterns are names, or
+// prefixes when they end with *. DynamoDB items are matched by their table, and the cached
+// responses and rows of HTTP upstreams and SQL queries, keyed "name?params", by their name
+func Allowed(cacheType string, name string) bool {
+	patterns, ok := serverConfig.Allow[cacheType]
+	if !ok {
+		return true
+	}
+
+	resource := name
 	switch cacheType {
-	case Dynamodb:
-		return plugins.FetchDynamoDbCache(name)
-	default:
-		return ""
+	case plugins.Dynamodb:
+		resource, _, _ = strings.Cut(name, "@@")
+	case plugins.Http, plugins.Sql:
+		resource, _, _ = strings.Cut(name, "?")
+	}
+	for _, pattern := range patterns {
+		if pattern == resource || (strings.HasSuffix(pattern, "*") && strings.HasPrefix(resource, strings.TrimSuffix(pattern, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the source of a cache type if it may be read with a name
+func getSource(cacheType string, name string) (plugins.Source, error) {
+	source, ok := plugins.GetSource(cacheType)
+	if !ok {
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownCacheType, cacheType)
+	}
+	if !Allowed(cacheType, name) {
+		return nil, fmt.Errorf("%w: '%s' of %s", ErrNotAllowed, name, cacheType)
+	}
+	return source, nil
+}
+
+// Route request to corresponding cache handlers
+func RouteCache(cacheType string, request plugins.CacheRequest) (plugins.CacheResult, error) {
+	source, err := getSource(cacheType, request.Name)
+	if err != nil {
+		return plugins.CacheResult{}, err
+	}
+	return source.Fetch(request)
+}
+
+// Route a query to the corresponding cache handler
+func RouteQuery(cacheType string, request plugins.CacheRequest) ([]plugins.CacheResult, error) {
+	source, err := getSource(cacheType, request.Name)
+	if err != nil {
+		return nil, err
+	}
+	querySource, ok := source.(plugins.QuerySource)
+	if !ok {
+		return nil, fmt.Errorf("%w by %s", ErrQueryNotSupported, cacheType)
+	}
+	return querySource.Query(request)
+}
+
+// Remove data from the corresponding cache handler
+func InvalidateCache(cacheType string, name string) error {
+	source, err := getSource(cacheType, name)
+	if err != nil {
+		return err
+	}
+	source.Invalidate(name)
+	return nil
+}
+
+// Return the names of the cached entries of a cache handler starting with a prefix, nil if the
+// handler cannot list its entries. Names the allowlist does not permit are left out
+func CacheKeys(cacheType string, prefix string) ([]string, error) {
+	source, ok := plugins.GetSource(cacheType)
+	if !ok {
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownCacheType, cacheType)
+	}
+	inspectSource, ok := source.(plugins.InspectSource)
+	if !ok {
+		return nil, nil
+	}
+
+	var keys []string
+	for _, name := range inspectSource.Keys(prefix) {
+		if Allowed(cacheType, name) {
+			keys = append(keys, name)
+		}
+	}
+	return keys, nil
+}
+
+// Return a cached entry of a cache handler without loading it from the origin
+func PeekCache(cacheType string, name string) (plugins.CacheData, bool) {
+	source, err := getSource(cacheType, name)
+	if err != nil {
+		return plugins.CacheData{}, false
+	}
+	if inspectSource, ok := source.(plugins.InspectSource); ok {
+		return inspectSource.Peek(name)
+	}
+	return plugins.CacheData{}, false
+}
+
+// Return the metadata of a cached entry. Sources which do not report it are described by the
+// cached data only
+func CacheEntry(cacheType string, name string) (plugins.EntryInfo, bool) {
+	source, err := getSource(cacheType, name)
+	if err != nil {
+		return plugins.EntryInfo{}, false
+	}
+	if adminSource, ok := source.(plugins.AdminSource); ok {
+		return adminSource.Entry(name)
+	}
+
+	data, ok := PeekCache(cacheType, name)
+	if !ok {
+		return plugins.EntryInfo{}, false
+	}
+	return plugins.EntryInfo{
+		Size:        len(name) + len(data.Data),
+		Tier:        plugins.TierMemory,
+		FetchedAt:   data.FetchedAt,
+		CacheExpiry: data.CacheExpiry,
+	}, true
+}
+
+// Return the number and size of the cached entries of a cache handler, or of all of them when
+// the cache type is empty. Handlers which do not report it and groups the allowlist does not
+// permit are left out
+func CacheUsage(cacheType string) (map[string]map[string]plugins.CacheUsage, error) {
+	cacheTypes := plugins.SourceTypes()
+	if cacheType != "" {
+		if _, ok := plugins.GetSource(cacheType); !ok {
+			return nil, fmt.Errorf("%w '%s'", ErrUnknownCacheType, cacheType)
+		}
+		cacheTypes = []string{cacheType}
+	}
+
+	usage := make(map[string]map[string]plugins.CacheUsage, len(cacheTypes))
+	for _, cacheType := range cacheTypes {
+		source, _ := plugins.GetSource(cacheType)
+		if adminSource, ok := source.(plugins.AdminSource); ok {
+			usage[cacheType] = allowedGroups(cacheType, adminSource.Usage())
+		}
+	}
+	return usage, nil
+}
+
+// Return the counters of a cache handler, or of all of them when the cache type is empty. Groups
+// the allowlist does not permit are left out
+func CacheStats(cacheType string) (map[string]map[string]plugins.CacheStats, error) {
+	cacheTypes := plugins.SourceTypes()
+	if cacheType != "" {
+		if _, ok := plugins.GetSource(cacheType); !ok {
+			return nil, fmt.Errorf("%w '%s'", ErrUnknownCacheType, cacheType)
+		}
+		cacheTypes = []string{cacheType}
+	}
+
+	stats := make(map[string]map[string]plugins.CacheStats, len(cacheTypes))
+	for _, cacheType := range cacheTypes {
+		source, _ := plugins.GetSource(cacheType)
+		stats[cacheType] = allowedGroups(cacheType, source.Stats())
+	}
+	return stats, nil
+}
+
+// Keep the groups of a source the allowlist permits, e.g. its tables or upstreams
+func allowedGroups[T any](cacheType string, groups map[string]T) map[string]T {
+	allowed := make(map[string]T, len(groups))
+	for group, value := range groups {
+		if Allowed(cacheType, group) {
+			allowed[group] = value
+		}
 	}
+	return allowed
 }
 
 // Load the config file
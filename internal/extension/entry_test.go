@@ -0,0 +1,93 @@
+package extension
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/plugins"
+	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/plugins/pluginstest"
+	"gopkg.in/yaml.v2"
+)
+
+var source = &pluginstest.Source{
+	Results:  map[string]plugins.CacheResult{"key": {Data: "value of key"}},
+	Counters: map[string]plugins.CacheStats{"public": {Hits: 1}, "private": {Hits: 2}},
+}
+
+func init() {
+	plugins.RegisterSource("fake", source)
+}
+
+func TestInitCache(t *testing.T) {
+	t.Setenv(InitializeCacheOnStartup, "true")
+	cacheConfig = CacheConfig{}
+	if err := yaml.Unmarshal([]byte("server:\n  listenAddress: unix:/tmp/cache.sock\nfake:\n  - name: first\n  - name: second\n"), &cacheConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	InitCache()
+	if ready, sources := Readiness(); ready || sources["fake"].State != plugins.WarmLoading {
+		t.Errorf("Expected the source to be loading until it is preloaded. Got %+v", sources)
+	}
+	PreloadCache()
+
+	if len(source.Configs) != 2 || source.Configs[1].Name != "second" {
+		t.Errorf("Expected the fake section to be passed to the source. Got %+v", source.Configs)
+	}
+	if !source.Preloaded {
+		t.Error("Expected the source to be preloaded")
+	}
+	if ready, sources := Readiness(); !ready || sources["fake"].State != plugins.WarmReady {
+		t.Errorf("Expected the preloaded source to be ready. Got %+v", sources)
+	}
+	if config := readServerConfiguration(); config.ListenAddress != "unix:/tmp/cache.sock" {
+		t.Errorf("Expected the server section not to be a source. Got %+v", config)
+	}
+	if result, err := RouteCache("fake", plugins.CacheRequest{Name: "key"}); err != nil || result.Data != "value of key" {
+		t.Errorf("Expected request to be routed to the source. Got %+v", result)
+	}
+	if _, err := RouteCache("unknown", plugins.CacheRequest{Name: "key"}); !errors.Is(err, ErrUnknownCacheType) {
+		t.Errorf("Expected an unknown cache type error. Got %v", err)
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	serverConfig = ServerConfiguration{Allow: map[string][]string{
+		"fake":           {"public", "app/*"},
+		plugins.Dynamodb: {"customers"},
+		plugins.Sql:      {"products"},
+	}}
+	defer func() { serverConfig = ServerConfiguration{} }()
+
+	tests := []struct {
+		cacheType string
+		name      string
+		allowed   bool
+	}{
+		{"fake", "public", true},
+		{"fake", "app/config", true},
+		{"fake", "private", false},
+		{"fake", "publicity", false},
+		{plugins.Dynamodb, "customers@@42", true},
+		{plugins.Dynamodb, "orders@@42", false},
+		{plugins.Sql, "products", true},
+		{plugins.Sql, "products?category=books", true},
+		{plugins.Sql, "orders?customer=42", false},
+		{"other", "anything", true},
+	}
+	for _, test := range tests {
+		if allowed := Allowed(test.cacheType, test.name); allowed != test.allowed {
+			t.Errorf("%s %s: expected allowed %t. Got %t", test.cacheType, test.name, test.allowed, allowed)
+		}
+	}
+
+	if _, err := RouteCache("fake", plugins.CacheRequest{Name: "private"}); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("Expected a not allowed error. Got %v", err)
+	}
+	if err := InvalidateCache("fake", "private"); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("Expected invalidation to be refused. Got %v", err)
+	}
+	if stats, _ := CacheStats("fake"); len(stats["fake"]) != 1 || stats["fake"]["public"].Hits != 1 {
+		t.Errorf("Expected only the counters of permitted names. Got %+v", stats)
+	}
+}
@@ -0,0 +1,55 @@
+package extension
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/plugins"
+	"gopkg.in/yaml.v2"
+)
+
+// Scan the Dynamodb tables configured in a cache.yaml file and write them to a snapshot file
+// which is deployed with the function and loaded when the extension starts
+func WriteSnapshotFile(configFile string, output string) error {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return err
+	}
+
+	config := CacheConfig{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("error while parsing %s: %w", configFile, err)
+	}
+	section, err := yaml.Marshal(config[plugins.Dynamodb])
+	if err != nil {
+		return err
+	}
+	var tableConfigs []plugins.DynamoDbConfiguration
+	if err := yaml.Unmarshal(section, &tableConfigs); err != nil {
+		return fmt.Errorf("error while reading %s configuration: %w", plugins.Dynamodb, err)
+	}
+	if len(tableConfigs) == 0 {
+		return fmt.Errorf("no %s tables are configured in %s", plugins.Dynamodb, configFile)
+	}
+
+	tables, err := plugins.ScanDynamoDbTables(tableConfigs)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	count, err := plugins.WriteSnapshot(file, tables...)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	println(plugins.PrintPrefix, fmt.Sprintf("Wrote %d items of %d tables to %s", count, len(tables), output))
+	return nil
+}
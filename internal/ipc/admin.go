@@ -0,0 +1,221 @@
+package ipc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/extension"
+	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/plugins"
+)
+
+// Lambda environment variable enabling the admin API, which is only served when a token is configured
+const AdminEnabled = "CACHE_EXTENSION_ADMIN"
+
+// Whether the admin API is served, read from CACHE_EXTENSION_ADMIN by Bind
+var adminEnabled bool
+
+// Prefix of the admin API
+const AdminPath = "/admin"
+
+// Number of keys of a page, by default and at most
+const (
+	defaultAdminLimit = 100
+	maxAdminLimit     = 1000
+)
+
+// Body of /admin/{cacheType}/keys, the cursor is empty on the last page
+type keysResponse struct {
+	Keys   []string `json:"keys"`
+	Cursor string   `json:"cursor,omitempty"`
+}
+
+// Body of /admin/{cacheType}/entry
+type entryResponse struct {
+	Name        string            `json:"name"`
+	Size        int               `json:"size"`
+	Tier        string            `json:"tier"`
+	FetchedAt   *time.Time        `json:"fetchedAt,omitempty"`
+	CacheExpiry *time.Time        `json:"cacheExpiry,omitempty"`
+	Hits        uint64            `json:"hits"`
+	Config      map[string]string `json:"config,omitempty"`
+}
+
+// Totals of a table or group of /admin/stats, entries and bytes are left out for sources which
+// do not report them
+type totalsResponse struct {
+	Entries      *int   `json:"entries,omitempty"`
+	Bytes        *int   `json:"bytes,omitempty"`
+	Hits         uint64 `json:"hits"`
+	Misses       uint64 `json:"misses"`
+	Evictions    uint64 `json:"evictions"`
+	OriginErrors uint64 `json:"originErrors"`
+	StaleServed  uint64 `json:"staleServed"`
+}
+
+// Register the admin routes, they must be matched before the lookup routes
+func registerAdminRoutes(router *mux.Router) {
+	admin := router.PathPrefix(AdminPath + "/").Subrouter()
+	admin.Use(adminGuard)
+	admin.Path("/stats").HandlerFunc(handleAdminStats)
+	admin.Path("/{cacheType}/stats").HandlerFunc(handleAdminStats)
+	admin.Path("/{cacheType}/keys").HandlerFunc(handleAdminKeys)
+	admin.Path("/{cacheType}/entry").HandlerFunc(handleAdminEntry)
+	admin.NotFoundHandler = router.NotFoundHandler
+}
+
+// Hide the admin API unless it is enabled and protected by a token
+func adminGuard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !adminEnabled || authToken == "" {
+			writeError(w, http.StatusNotFound, CodeNotFound, "no route for "+r.URL.Path)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// List the cached keys starting with prefix in alphabetical order, a page of limit keys after cursor
+func handleAdminKeys(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := defaultAdminLimit
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxAdminLimit {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "limit must be between 1 and "+strconv.Itoa(maxAdminLimit))
+			return
+		}
+	}
+
+	keys, err := extension.CacheKeys(mux.Vars(r)["cacheType"], query.Get("prefix"))
+	if err != nil {
+		status, code := errorStatus(err)
+		writeError(w, status, code, err.Error())
+		return
+	}
+
+	// The cursor is the last key of the previous page, so pages stay stable while entries change
+	start := 0
+	if cursor := query.Get("cursor"); cursor != "" {
+		start = sort.Search(len(keys), func(i int) bool { return keys[i] > cursor })
+	}
+	end := start + limit
+	response := keysResponse{Keys: []string{}}
+	if end < len(keys) {
+		response.Cursor = keys[end-1]
+	} else {
+		end = len(keys)
+	}
+	response.Keys = append(response.Keys, keys[start:end]...)
+	writeJson(w, response)
+}
+
+// Show the metadata of the cached entry given by the name query parameter
+func handleAdminEntry(w http.ResponseWriter, r *http.Request) {
+	cacheType := mux.Vars(r)["cacheType"]
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "name is required")
+		return
+	}
+	if _, ok := plugins.GetSource(cacheType); !ok {
+		writeError(w, http.StatusNotFound, CodeUnknownCacheType, "unknown cache type '"+cacheType+"'")
+		return
+	}
+
+	info, ok := extension.CacheEntry(cacheType, name)
+	if !ok {
+		writeError(w, http.StatusNotFound, CodeNotFound, "'"+name+"' is not cached")
+		return
+	}
+	writeJson(w, entryResponse{
+		Name:        name,
+		Size:        info.Size,
+		Tier:        info.Tier,
+		FetchedAt:   optionalTime(info.FetchedAt),
+		CacheExpiry: optionalTime(info.CacheExpiry),
+		Hits:        info.Hits,
+		Config:      info.Config,
+	})
+}
+
+// Show the totals of every table or group of a cache type, or of all cache types
+func handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	cacheType := mux.Vars(r)["cacheType"]
+	stats, err := extension.CacheStats(cacheType)
+	if err == nil {
+		var usage map[string]map[string]plugins.CacheUsage
+		usage, err = extension.CacheUsage(cacheType)
+		if err == nil {
+			writeJson(w, adminTotals(stats, usage))
+			return
+		}
+	}
+	status, code := errorStatus(err)
+	writeError(w, status, code, err.Error())
+}
+
+// Merge the counters and usage of every group
+func adminTotals(stats map[string]map[string]plugins.CacheStats, usage map[string]map[string]plugins.CacheUsage) map[string]map[string]totalsResponse {
+	totals := make(map[string]map[string]totalsResponse, len(stats))
+	for cacheType, groups := range stats {
+		totals[cacheType] = make(map[string]totalsResponse, len(groups))
+		for group, groupStats := range groups {
+			totals[cacheType][group] = totalsResponse{
+				Hits:         groupStats.Hits,
+				Misses:       groupStats.Misses,
+				Evictions:    groupStats.Evictions,
+				OriginErrors: groupStats.OriginErrors,
+				StaleServed:  groupStats.StaleServed,
+			}
+		}
+	}
+
+	// Groups with cached entries may not have counters yet, e.g. tables loaded on startup, and
+	// groups with counters may have no cached entries
+	for cacheType, groups := range usage {
+		if totals[cacheType] == nil {
+			totals[cacheType] = make(map[string]totalsResponse, len(groups))
+		}
+		for group, groupUsage := range groups {
+			groupTotals := totals[cacheType][group]
+			entries, bytes := groupUsage.Entries, groupUsage.Bytes
+			groupTotals.Entries, groupTotals.Bytes = &entries, &bytes
+			totals[cacheType][group] = groupTotals
+		}
+		for group, groupTotals := range totals[cacheType] {
+			if groupTotals.Entries == nil {
+				entries, bytes := 0, 0
+				groupTotals.Entries, groupTotals.Bytes = &entries, &bytes
+				totals[cacheType][group] = groupTotals
+			}
+		}
+	}
+	return totals
+}
+
+func writeJson(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// Read CACHE_EXTENSION_ADMIN, the admin API is disabled by default
+func loadAdminEnabled() (bool, error) {
+	value := os.Getenv(AdminEnabled)
+	if value == "" {
+		return false, nil
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s env variable %s", AdminEnabled, value)
+	}
+	return enabled, nil
+}
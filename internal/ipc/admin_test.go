@@ -0,0 +1,99 @@
+package ipc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Get an admin path with the token and decode the JSON body
+func getAdmin(t *testing.T, url string, body interface{}) int {
+	request, _ := http.NewRequest(http.MethodGet, url, nil)
+	request.Header.Set(TokenHeader, "secret")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer response.Body.Close()
+	if err := json.NewDecoder(response.Body).Decode(body); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	return response.StatusCode
+}
+
+func enableAdmin(t *testing.T, enabled bool) {
+	adminEnabled = enabled
+	t.Cleanup(func() { adminEnabled = false })
+}
+
+func TestAdminGuard(t *testing.T) {
+	server := httptest.NewServer(newRouter())
+	defer server.Close()
+
+	enableAdmin(t, true)
+	var body errorResponse
+	if status := getAdmin(t, server.URL+"/admin/stats", &body); status != http.StatusNotFound {
+		t.Errorf("Expected the admin API to be hidden without token. Got %d", status)
+	}
+
+	requireToken(t, "secret")
+	enableAdmin(t, false)
+	if status := getAdmin(t, server.URL+"/admin/stats", &body); status != http.StatusNotFound {
+		t.Errorf("Expected the admin API to be hidden when disabled. Got %d", status)
+	}
+}
+
+func TestAdminKeys(t *testing.T) {
+	requireToken(t, "secret")
+	enableAdmin(t, true)
+	server := httptest.NewServer(newRouter())
+	defer server.Close()
+
+	var page keysResponse
+	if status := getAdmin(t, server.URL+"/admin/ipc-test/keys?limit=1", &page); status != http.StatusOK ||
+		len(page.Keys) != 1 || page.Keys[0] != "json" || page.Cursor != "json" {
+		t.Errorf("Expected the first page of keys. Got %d %+v", status, page)
+	}
+	page = keysResponse{}
+	getAdmin(t, server.URL+"/admin/ipc-test/keys?limit=1&cursor=json", &page)
+	if len(page.Keys) != 1 || page.Keys[0] != "plain" || page.Cursor != "" {
+		t.Errorf("Expected the last page of keys. Got %+v", page)
+	}
+	page = keysResponse{}
+	getAdmin(t, server.URL+"/admin/ipc-test/keys?prefix=p", &page)
+	if len(page.Keys) != 1 || page.Keys[0] != "plain" {
+		t.Errorf("Expected keys starting with the prefix. Got %+v", page)
+	}
+
+	var body errorResponse
+	if status := getAdmin(t, server.URL+"/admin/ipc-test/keys?limit=0", &body); status != http.StatusBadRequest {
+		t.Errorf("Expected an invalid limit to be rejected. Got %d", status)
+	}
+	if status := getAdmin(t, server.URL+"/admin/unknown/keys", &body); status != http.StatusNotFound || body.Error.Code != CodeUnknownCacheType {
+		t.Errorf("Expected an unknown cache type. Got %d %+v", status, body)
+	}
+}
+
+func TestAdminEntryAndStats(t *testing.T) {
+	requireToken(t, "secret")
+	enableAdmin(t, true)
+	server := httptest.NewServer(newRouter())
+	defer server.Close()
+
+	var entry entryResponse
+	if status := getAdmin(t, server.URL+"/admin/ipc-test/entry?name=json", &entry); status != http.StatusOK ||
+		entry.Size != len("json")+len(`{"a":1}`) || entry.CacheExpiry == nil || entry.CacheExpiry.Year() != 2030 {
+		t.Errorf("Expected the metadata of the entry. Got %d %+v", status, entry)
+	}
+	var body errorResponse
+	if status := getAdmin(t, server.URL+"/admin/ipc-test/entry?name=missing", &body); status != http.StatusNotFound || body.Error.Code != CodeNotFound {
+		t.Errorf("Expected an entry which is not cached not to be found. Got %d %+v", status, body)
+	}
+
+	var totals map[string]map[string]totalsResponse
+	if status := getAdmin(t, server.URL+"/admin/ipc-test/stats", &totals); status != http.StatusOK ||
+		len(totals) != 1 || totals["ipc-test"]["json"].OriginErrors != 2 || totals["ipc-test"]["json"].Entries != nil {
+		t.Errorf("Expected the counters of the source. Got %d %+v", status, totals)
+	}
+}
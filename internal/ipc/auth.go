@@ -0,0 +1,100 @@
+package ipc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Lambda environment variables for the token clients must send. When only the file is set, a
+// random token is generated and written to it so that the function can read it
+const (
+	AuthToken     = "CACHE_EXTENSION_AUTH_TOKEN"
+	AuthTokenFile = "CACHE_EXTENSION_AUTH_TOKEN_FILE"
+)
+
+// Header carrying the token, Authorization: Bearer <token> is accepted as well
+const TokenHeader = "X-Cache-Token"
+
+// Token clients must send, empty when authentication is disabled
+var authToken string
+
+// Read the token from CACHE_EXTENSION_AUTH_TOKEN, or generate one into CACHE_EXTENSION_AUTH_TOKEN_FILE
+func loadAuthToken() (string, error) {
+	if token := os.Getenv(AuthToken); token != "" {
+		return token, nil
+	}
+	path := os.Getenv(AuthTokenFile)
+	if path == "" {
+		return "", nil
+	}
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(random)
+	if err := os.WriteFile(path, []byte(token), 0600); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Check a token sent by a client, any token is valid when authentication is disabled
+func validToken(token string) bool {
+	return authToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(authToken)) == 1
+}
+
+// Return the token of a bearer authorization
+func bearerToken(authorization string) string {
+	scheme, token, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// Reject HTTP requests without valid token, except liveness checks
+func authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == HealthPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token := r.Header.Get(TokenHeader)
+		if token == "" {
+			token = bearerToken(r.Header.Get("Authorization"))
+		}
+		if !validToken(token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "a valid token is required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Reject gRPC calls without valid token in their metadata
+func authInterceptor(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(strings.ToLower(TokenHeader)); len(values) > 0 {
+			token = values[0]
+		} else if values := md.Get("authorization"); len(values) > 0 {
+			token = bearerToken(values[0])
+		}
+	}
+	if !validToken(token) {
+		return nil, status.Error(codes.Unauthenticated, "a valid token is required")
+	}
+	return handler(ctx, request)
+}
@@ -0,0 +1,120 @@
+package ipc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/ipc/cachepb"
+)
+
+// Require a token for the duration of a test
+func requireToken(t *testing.T, token string) {
+	authToken = token
+	t.Cleanup(func() { authToken = "" })
+}
+
+func TestLoadAuthToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	t.Setenv(AuthTokenFile, path)
+
+	token, err := loadAuthToken()
+	if err != nil || len(token) != 64 {
+		t.Fatalf("Expected a generated token. Got %s, %v", token, err)
+	}
+	if written, _ := os.ReadFile(path); string(written) != token {
+		t.Errorf("Expected the token to be written to the file. Got %s", written)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the file to be private. Got %s", info.Mode())
+	}
+
+	t.Setenv(AuthToken, "configured")
+	if token, _ := loadAuthToken(); token != "configured" {
+		t.Errorf("Expected the configured token. Got %s", token)
+	}
+}
+
+func TestHttpAuth(t *testing.T) {
+	requireToken(t, "secret")
+	server := httptest.NewServer(newRouter())
+	defer server.Close()
+
+	tests := []struct {
+		header string
+		value  string
+		status int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{TokenHeader, "wrong", http.StatusUnauthorized},
+		{TokenHeader, "secret", http.StatusOK},
+		{"Authorization", "Bearer secret", http.StatusOK},
+		{"Authorization", "Basic secret", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		request, _ := http.NewRequest(http.MethodGet, server.URL+"/ipc-test/json", nil)
+		if test.header != "" {
+			request.Header.Set(test.header, test.value)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		response.Body.Close()
+		if response.StatusCode != test.status {
+			t.Errorf("%s %s: expected %d. Got %d", test.header, test.value, test.status, response.StatusCode)
+		}
+	}
+}
+
+func TestGrpcAuth(t *testing.T) {
+	requireToken(t, "secret")
+	client := newGrpcClient(t)
+	request := &cachepb.GetRequest{CacheType: "ipc-test", Name: "json"}
+
+	if _, err := client.Get(context.Background(), request); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected call without token to be rejected. Got %v", err)
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-cache-token", "secret")
+	if _, err := client.Get(ctx, request); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+func TestRespAuth(t *testing.T) {
+	requireToken(t, "secret")
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer listener.Close()
+	go serveResp(listener)
+	ctx := context.Background()
+
+	anonymous := redis.NewClient(&redis.Options{Addr: listener.Addr().String()})
+	defer anonymous.Close()
+	if err := anonymous.Get(ctx, "ipc-test:json").Err(); err == nil || err.Error() != errRespNoAuth.Error() {
+		t.Errorf("Expected NOAUTH without token. Got %v", err)
+	}
+
+	wrong := redis.NewClient(&redis.Options{Addr: listener.Addr().String(), Password: "wrong"})
+	defer wrong.Close()
+	if err := wrong.Ping(ctx).Err(); err == nil {
+		t.Error("Expected a wrong token to be rejected")
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: listener.Addr().String(), Password: "secret"})
+	defer client.Close()
+	if value, err := client.Get(ctx, "ipc-test:json").Result(); err != nil || value != `{"a":1}` {
+		t.Errorf("Expected cached value with token. Got %s, %v", value, err)
+	}
+}
@@ -0,0 +1,173 @@
+package ipc
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/extension"
+	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/ipc/cachepb"
+	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/plugins"
+)
+
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative internal/ipc/cachepb/cache.proto
+
+// gRPC service serving lookups of the same sources as the HTTP server
+type cacheServer struct {
+	cachepb.UnimplementedCacheServer
+}
+
+func newGrpcServer() *grpc.Server {
+	server := grpc.NewServer(grpc.UnaryInterceptor(authInterceptor))
+	cachepb.RegisterCacheServer(server, &cacheServer{})
+	return server
+}
+
+func (s *cacheServer) Get(ctx context.Context, request *cachepb.GetRequest) (*cachepb.Value, error) {
+	if request.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	result, err := extension.RouteCache(request.CacheType, getRequest(request))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return value(result), nil
+}
+
+// Look up every value of the batch, failed lookups are returned as errors of their own
+func (s *cacheServer) BatchGet(ctx context.Context, request *cachepb.BatchGetRequest) (*cachepb.BatchGetResponse, error) {
+	response := &cachepb.BatchGetResponse{Results: make([]*cachepb.BatchGetResult, 0, len(request.Requests))}
+	for _, get := range request.Requests {
+		if get.Name == "" {
+			response.Results = append(response.Results, batchError(CodeInvalidRequest, "name is required"))
+			continue
+		}
+		result, err := extension.RouteCache(get.CacheType, getRequest(get))
+		if err != nil {
+			_, code := errorStatus(err)
+			response.Results = append(response.Results, batchError(code, err.Error()))
+			continue
+		}
+		response.Results = append(response.Results, &cachepb.BatchGetResult{
+			Result: &cachepb.BatchGetResult_Value{Value: value(result)},
+		})
+	}
+	return response, nil
+}
+
+func (s *cacheServer) Query(ctx context.Context, request *cachepb.QueryRequest) (*cachepb.QueryResponse, error) {
+	if request.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	results, err := extension.RouteQuery(request.CacheType, plugins.CacheRequest{Name: request.Name, NoCache: request.NoCache})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	response := &cachepb.QueryResponse{Values: make([]*cachepb.Value, 0, len(results))}
+	for _, result := range results {
+		response.Values = append(response.Values, value(result))
+	}
+	return response, nil
+}
+
+func (s *cacheServer) Invalidate(ctx context.Context, request *cachepb.InvalidateRequest) (*cachepb.InvalidateResponse, error) {
+	if request.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	if err := extension.InvalidateCache(request.CacheType, request.Name); err != nil {
+		return nil, grpcError(err)
+	}
+	return &cachepb.InvalidateResponse{}, nil
+}
+
+// Return the counters sorted by cache type and group
+func (s *cacheServer) Stats(ctx context.Context, request *cachepb.StatsRequest) (*cachepb.StatsResponse, error) {
+	stats, err := extension.CacheStats(request.CacheType)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	response := &cachepb.StatsResponse{}
+	for cacheType, groups := range stats {
+		for group, groupStats := range groups {
+			response.Stats = append(response.Stats, &cachepb.SourceStats{
+				CacheType:    cacheType,
+				Group:        group,
+				OriginErrors: groupStats.OriginErrors,
+				StaleServed:  groupStats.StaleServed,
+				Evictions:    groupStats.Evictions,
+				Hits:         groupStats.Hits,
+				Misses:       groupStats.Misses,
+			})
+		}
+	}
+	sort.Slice(response.Stats, func(i, j int) bool {
+		if response.Stats[i].CacheType != response.Stats[j].CacheType {
+			return response.Stats[i].CacheType < response.Stats[j].CacheType
+		}
+		return response.Stats[i].Group < response.Stats[j].Group
+	})
+	return response, nil
+}
+
+// Build the lookup of a gRPC request
+func getRequest(request *cachepb.GetRequest) plugins.CacheRequest {
+	params := request.Params
+	if params == nil {
+		params = map[string]string{}
+	}
+	return plugins.CacheRequest{Name: request.Name, Params: params, NoCache: request.NoCache}
+}
+
+// Convert the result of a lookup to its message
+func value(result plugins.CacheResult) *cachepb.Value {
+	value := &cachepb.Value{
+		Data:        []byte(result.Data),
+		ContentType: result.ContentType,
+		Status:      string(result.Status),
+		Tier:        result.Tier,
+		Key:         result.Key,
+	}
+	if !result.FetchedAt.IsZero() {
+		value.FetchedAt = timestamppb.New(result.FetchedAt)
+	}
+	if !result.CacheExpiry.IsZero() {
+		value.CacheExpiry = timestamppb.New(result.CacheExpiry)
+	}
+	return value
+}
+
+func batchError(code string, message string) *cachepb.BatchGetResult {
+	return &cachepb.BatchGetResult{
+		Result: &cachepb.BatchGetResult_Error{Error: &cachepb.Error{Code: code, Message: message}},
+	}
+}
+
+// Map the error of a lookup to its gRPC status, following the status codes of the HTTP server
+func grpcError(err error) error {
+	if errors.Is(err, extension.ErrQueryNotSupported) {
+		return status.Error(codes.Unimplemented, err.Error())
+	}
+
+	_, code := errorStatus(err)
+	switch code {
+	case CodeNotFound, CodeUnknownCacheType:
+		return status.Error(codes.NotFound, err.Error())
+	case CodeInvalidRequest:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case CodeTooLarge:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case CodeForbidden:
+		return status.Error(codes.PermissionDenied, err.Error())
+	case CodeOriginTimeout:
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		return status.Error(codes.Unavailable, err.Error())
+	}
+}
@@ -0,0 +1,113 @@
+package ipc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/ipc/cachepb"
+	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/plugins"
+	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/plugins/pluginstest"
+)
+
+// Start the gRPC server on an in-memory listener and connect a client to it
+func newGrpcClient(t *testing.T) cachepb.CacheClient {
+	listener := bufconn.Listen(1024 * 1024)
+	server := newGrpcServer()
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return cachepb.NewCacheClient(conn)
+}
+
+func TestGrpcGet(t *testing.T) {
+	client := newGrpcClient(t)
+	ctx := context.Background()
+
+	value, err := client.Get(ctx, &cachepb.GetRequest{CacheType: "ipc-test", Name: "json", NoCache: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if string(value.Data) != `{"a":1}` || value.ContentType != "application/json" || value.Status != "HIT" ||
+		value.Key != "json" || value.CacheExpiry.AsTime().Year() != 2030 {
+		t.Errorf("Expected value of the source. Got %+v", value)
+	}
+	if !testSource.Last.NoCache {
+		t.Error("Expected no_cache to skip the cache")
+	}
+
+	tests := []struct {
+		request *cachepb.GetRequest
+		code    codes.Code
+	}{
+		{&cachepb.GetRequest{CacheType: "ipc-test"}, codes.InvalidArgument},
+		{&cachepb.GetRequest{CacheType: "ipc-test", Name: "missing"}, codes.NotFound},
+		{&cachepb.GetRequest{CacheType: "unknown", Name: "json"}, codes.NotFound},
+		{&cachepb.GetRequest{CacheType: "ipc-test", Name: "down"}, codes.Unavailable},
+		{&cachepb.GetRequest{CacheType: "ipc-test", Name: "slow"}, codes.DeadlineExceeded},
+	}
+	for _, test := range tests {
+		if _, err := client.Get(ctx, test.request); status.Code(err) != test.code {
+			t.Errorf("%s: expected %s. Got %v", test.request.Name, test.code, err)
+		}
+	}
+
+	response, err := client.BatchGet(ctx, &cachepb.BatchGetRequest{Requests: []*cachepb.GetRequest{
+		{CacheType: "ipc-test", Name: "plain"},
+		{CacheType: "ipc-test", Name: "down"},
+	}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(response.Results) != 2 || string(response.Results[0].GetValue().GetData()) != "text" ||
+		response.Results[1].GetError().GetCode() != CodeOriginUnavailable {
+		t.Errorf("Expected a value and an error. Got %+v", response.Results)
+	}
+}
+
+func TestGrpcQueryInvalidateStats(t *testing.T) {
+	client := newGrpcClient(t)
+	ctx := context.Background()
+
+	response, err := client.Query(ctx, &cachepb.QueryRequest{CacheType: "ipc-test", Name: "js"})
+	if err != nil || len(response.Values) != 1 || string(response.Values[0].Data) != `{"a":1}` {
+		t.Errorf("Expected values matching the query. Got %+v, %v", response, err)
+	}
+
+	if _, err := client.Query(ctx, &cachepb.QueryRequest{CacheType: "ipc-test-plain", Name: "a"}); status.Code(err) != codes.Unimplemented {
+		t.Errorf("Expected queries of a source without query support to be unimplemented. Got %v", err)
+	}
+
+	if _, err := client.Invalidate(ctx, &cachepb.InvalidateRequest{CacheType: "ipc-test", Name: "json"}); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if n := len(testSource.Invalidated); n == 0 || testSource.Invalidated[n-1] != "json" {
+		t.Errorf("Expected entry to be invalidated. Got %v", testSource.Invalidated)
+	}
+
+	stats, err := client.Stats(ctx, &cachepb.StatsRequest{CacheType: "ipc-test"})
+	if err != nil || len(stats.Stats) != 1 || stats.Stats[0].Group != "json" || stats.Stats[0].OriginErrors != 2 ||
+		stats.Stats[0].Hits != 5 || stats.Stats[0].Misses != 3 {
+		t.Errorf("Expected counters of the source. Got %+v, %v", stats, err)
+	}
+	if _, err := client.Stats(ctx, &cachepb.StatsRequest{CacheType: "unknown"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected unknown cache type not to be found. Got %v", err)
+	}
+}
+
+func init() {
+	plugins.RegisterSource("ipc-test-plain", &pluginstest.Source{})
+}
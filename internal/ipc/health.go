@@ -0,0 +1,78 @@
+package ipc
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/extension"
+	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/plugins"
+)
+
+// Paths of the liveness and readiness endpoints, registered before the lookup routes
+const (
+	HealthPath = "/health"
+	ReadyPath  = "/ready"
+)
+
+// Body of /ready
+type readyResponse struct {
+	Ready   bool                    `json:"ready"`
+	Sources map[string]sourceWarmup `json:"sources"`
+}
+
+type sourceWarmup struct {
+	State  plugins.WarmState      `json:"state"`
+	Error  string                 `json:"error,omitempty"`
+	Tables map[string]tableWarmup `json:"tables,omitempty"`
+}
+
+type tableWarmup struct {
+	State       plugins.WarmState `json:"state"`
+	Items       int               `json:"items"`
+	LoadedAt    *time.Time        `json:"loadedAt,omitempty"`
+	LastError   string            `json:"lastError,omitempty"`
+	LastErrorAt *time.Time        `json:"lastErrorAt,omitempty"`
+}
+
+// Answer as long as the extension is running, no token is required
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"status":"ok"}` + "\n"))
+}
+
+// Report the warmup of every source, 503 until the cache is ready
+func handleReady(w http.ResponseWriter, r *http.Request) {
+	ready, sources := extension.Readiness()
+	response := readyResponse{Ready: ready, Sources: make(map[string]sourceWarmup, len(sources))}
+	for cacheType, warmup := range sources {
+		source := sourceWarmup{State: warmup.State, Error: warmup.Error}
+		if len(warmup.Groups) > 0 {
+			source.Tables = make(map[string]tableWarmup, len(warmup.Groups))
+		}
+		for group, status := range warmup.Groups {
+			source.Tables[group] = tableWarmup{
+				State:       status.State,
+				Items:       status.Items,
+				LoadedAt:    optionalTime(status.LoadedAt),
+				LastError:   status.LastError,
+				LastErrorAt: optionalTime(status.LastErrorAt),
+			}
+		}
+		response.Sources[cacheType] = source
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// Omit times which are not set
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
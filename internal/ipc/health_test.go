@@ -0,0 +1,47 @@
+package ipc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthAndReady(t *testing.T) {
+	requireToken(t, "secret")
+	server := httptest.NewServer(newRouter())
+	defer server.Close()
+
+	response, err := http.Get(server.URL + HealthPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("Expected liveness without token. Got %d", response.StatusCode)
+	}
+
+	response, err = http.Get(server.URL + ReadyPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected readiness to require the token. Got %d", response.StatusCode)
+	}
+
+	request, _ := http.NewRequest(http.MethodGet, server.URL+ReadyPath, nil)
+	request.Header.Set(TokenHeader, "secret")
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer response.Body.Close()
+	var body readyResponse
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if response.StatusCode != http.StatusOK || !body.Ready {
+		t.Errorf("Expected ready without configured sources. Got %d %+v", response.StatusCode, body)
+	}
+}
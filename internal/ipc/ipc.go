@@ -1,35 +1,190 @@
 package ipc
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
 	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/extension"
 	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/plugins"
-	"github.com/gorilla/mux"
-	"net/http"
 )
 
-// Start begins running the sidecar
-func Start(port string) {
-	go startHTTPServer(port)
+// Error codes of the JSON error responses
+const (
+	CodeInvalidRequest    = "invalid_request"
+	CodeTooLarge          = "too_large"
+	CodeNotFound          = "not_found"
+	CodeUnknownCacheType  = "unknown_cache_type"
+	CodeOriginUnavailable = "origin_unavailable"
+	CodeOriginTimeout     = "origin_timeout"
+	CodeNotAcceptable     = "not_acceptable"
+	CodeInternalError     = "internal_error"
+	CodeUnauthorized      = "unauthorized"
+	CodeForbidden         = "forbidden"
+)
+
+// Body of error responses, {"error": {"code": "...", "message": "..."}}
+type errorResponse struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
 
-// Method that responds back with the cached values
-func startHTTPServer(port string) {
+// Create the router serving lookups as /{cacheType}?name=... or /{cacheType}/{name}
+func newRouter() *mux.Router {
 	router := mux.NewRouter()
-	router.Path("/{cacheType}").Queries("name", "{name}").HandlerFunc(
-		func(w http.ResponseWriter, r *http.Request) {
-			vars := mux.Vars(r)
-			value := extension.RouteCache(vars["cacheType"], vars["name"])
-
-			if len(value) != 0 {
-				_, _ = w.Write([]byte(value))
-			} else {
-				_, _ = w.Write([]byte("No data found"))
-			}
-		})
-
-	println(plugins.PrintPrefix, "Starting Httpserver on port ", port)
-	err := http.ListenAndServe(":"+port, router)
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "no route for "+r.URL.Path)
+	})
+	router.Use(authMiddleware)
+	router.Path(HealthPath).HandlerFunc(handleHealth)
+	router.Path(ReadyPath).HandlerFunc(handleReady)
+	registerAdminRoutes(router)
+	router.Path("/{cacheType}").HandlerFunc(handleLookup)
+	// The name may also be given as path, e.g. /sql/{queryName}?param=value
+	router.Path("/{cacheType}/{name}").HandlerFunc(handleLookup)
+	return router
+}
+
+// Respond with the cached value of a lookup or a JSON error
+func handleLookup(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
+	if name == "" {
+		name = r.URL.Query().Get("name")
+	}
+	if name == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "name is required")
+		return
+	}
+
+	result, err := extension.RouteCache(vars["cacheType"], cacheRequest(r, name))
 	if err != nil {
-		panic(err)
+		status, code := errorStatus(err)
+		writeError(w, status, code, err.Error())
+		return
+	}
+
+	body, contentType, err := render(result.Data, result.ContentType, r.Header.Get("Accept"))
+	if errors.Is(err, errNotAcceptable) {
+		writeError(w, http.StatusNotAcceptable, CodeNotAcceptable, "value of '"+name+"' cannot be rendered as "+r.Header.Get("Accept"))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternalError, "could not render value of '"+name+"': "+err.Error())
+		return
+	}
+
+	// Every representation gets its own tag, compressed bodies are tagged with their encoding
+	encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), len(body))
+	etag := entityTag(string(body))
+	if encoding != "" {
+		etag = strings.TrimSuffix(etag, `"`) + "-" + encoding + `"`
+	}
+	w.Header().Set("Vary", "Accept, Accept-Encoding")
+	setCacheHeaders(w.Header(), result, etag)
+	if matchesETag(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	body, err = compress(body, encoding)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternalError, "could not compress value of '"+name+"': "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	_, _ = w.Write(body)
+}
+
+// Set the headers describing how a lookup was answered
+func setCacheHeaders(header http.Header, result plugins.CacheResult, etag string) {
+	header.Set("X-Cache", string(result.Status))
+	header.Set("X-Cache-Tier", result.Tier)
+	header.Set("X-Cache-Key", result.Key)
+	header.Set("ETag", etag)
+	if !result.FetchedAt.IsZero() {
+		age := time.Since(result.FetchedAt)
+		if age < 0 {
+			age = 0
+		}
+		header.Set("Age", strconv.Itoa(int(age.Seconds())))
+	}
+	if !result.CacheExpiry.IsZero() {
+		header.Set("X-Cache-Expires", result.CacheExpiry.UTC().Format(http.TimeFormat))
+	}
+}
+
+// Strong entity tag of a value, the same value always gets the same tag
+func entityTag(data string) string {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(data))
+	return fmt.Sprintf(`"%016x"`, hash.Sum64())
+}
+
+// Check whether an If-None-Match header lists the entity tag
+func matchesETag(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Map the error of a lookup to its HTTP status and error code
+func errorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, extension.ErrUnknownCacheType):
+		return http.StatusNotFound, CodeUnknownCacheType
+	case errors.Is(err, plugins.ErrNotFound):
+		return http.StatusNotFound, CodeNotFound
+	case errors.Is(err, extension.ErrNotAllowed):
+		return http.StatusForbidden, CodeForbidden
+	case errors.Is(err, plugins.ErrInvalidRequest):
+		return http.StatusBadRequest, CodeInvalidRequest
+	case errors.Is(err, plugins.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge, CodeTooLarge
+	case errors.Is(err, plugins.ErrOriginTimeout):
+		return http.StatusGatewayTimeout, CodeOriginTimeout
+	default:
+		return http.StatusBadGateway, CodeOriginUnavailable
+	}
+}
+
+// Write a JSON error response
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(errorResponse{Error: errorDetail{Code: code, Message: message}})
+}
+
+// Build the lookup of a request, query parameters other than name are passed to the source.
+// Cache-Control: no-cache skips the cached data
+func cacheRequest(r *http.Request, name string) plugins.CacheRequest {
+	request := plugins.CacheRequest{Name: name, Params: map[string]string{}}
+	for _, directive := range strings.Split(r.Header.Get("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-cache") {
+			request.NoCache = true
+		}
+	}
+	for param, values := range r.URL.Query() {
+		if param != "name" && len(values) > 0 {
+			request.Params[param] = values[0]
+		}
 	}
+	return request
 }
@@ -0,0 +1,129 @@
+package ipc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/plugins"
+	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/plugins/pluginstest"
+)
+
+var testSource = &pluginstest.QuerySource{Source: pluginstest.Source{
+	Results: map[string]plugins.CacheResult{
+		"json": {
+			Data:        `{"a":1}`,
+			ContentType: "application/json",
+			Status:      plugins.CacheHit,
+			Tier:        plugins.TierMemory,
+			Key:         "json",
+			CacheExpiry: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		"plain": {Data: "text"},
+	},
+	Errors: map[string]error{
+		"down":      fmt.Errorf("%w: connection refused", plugins.ErrOriginUnavailable),
+		"slow":      fmt.Errorf("%w: deadline exceeded", plugins.ErrOriginTimeout),
+		"invalid":   fmt.Errorf("%w: missing parameter", plugins.ErrInvalidRequest),
+		"oversized": fmt.Errorf("%w: object exceeds 4 bytes", plugins.ErrTooLarge),
+	},
+	Counters: map[string]plugins.CacheStats{"json": {Hits: 5, Misses: 3, OriginErrors: 2}},
+}}
+
+func init() {
+	plugins.RegisterSource("ipc-test", testSource)
+}
+
+func TestLookupStatus(t *testing.T) {
+	server := httptest.NewServer(newRouter())
+	defer server.Close()
+
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+		code        string
+	}{
+		{"/ipc-test?name=json", http.StatusOK, "application/json", ""},
+		{"/ipc-test/plain", http.StatusOK, "text/plain; charset=utf-8", ""},
+		{"/ipc-test", http.StatusBadRequest, "application/json", CodeInvalidRequest},
+		{"/ipc-test?name=invalid", http.StatusBadRequest, "application/json", CodeInvalidRequest},
+		{"/ipc-test/oversized", http.StatusRequestEntityTooLarge, "application/json", CodeTooLarge},
+		{"/ipc-test?name=missing", http.StatusNotFound, "application/json", CodeNotFound},
+		{"/unknown?name=json", http.StatusNotFound, "application/json", CodeUnknownCacheType},
+		{"/ipc-test/down", http.StatusBadGateway, "application/json", CodeOriginUnavailable},
+		{"/ipc-test/slow", http.StatusGatewayTimeout, "application/json", CodeOriginTimeout},
+	}
+	for _, test := range tests {
+		response, err := http.Get(server.URL + test.path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if response.StatusCode != test.status || response.Header.Get("Content-Type") != test.contentType {
+			t.Errorf("%s: expected %d with %s. Got %d with %s", test.path, test.status, test.contentType,
+				response.StatusCode, response.Header.Get("Content-Type"))
+		}
+		if test.code != "" {
+			var body errorResponse
+			if err := json.NewDecoder(response.Body).Decode(&body); err != nil || body.Error.Code != test.code || body.Error.Message == "" {
+				t.Errorf("%s: expected error code %s. Got %+v, %v", test.path, test.code, body, err)
+			}
+		}
+		response.Body.Close()
+	}
+}
+
+func TestCacheHeaders(t *testing.T) {
+	server := httptest.NewServer(newRouter())
+	defer server.Close()
+
+	result := testSource.Results["json"]
+	result.FetchedAt = time.Now().Add(-90 * time.Second)
+	testSource.Results["json"] = result
+
+	response, err := http.Get(server.URL + "/ipc-test/json")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	response.Body.Close()
+	header := response.Header
+	if header.Get("X-Cache") != "HIT" || header.Get("X-Cache-Tier") != "memory" || header.Get("X-Cache-Key") != "json" {
+		t.Errorf("Expected cache status headers. Got %v", header)
+	}
+	if header.Get("Age") != "90" || header.Get("X-Cache-Expires") != "Wed, 02 Jan 2030 03:04:05 GMT" {
+		t.Errorf("Expected age and expiry headers. Got %v", header)
+	}
+	etag := header.Get("ETag")
+	if etag == "" || etag != entityTag(`{"a":1}`) {
+		t.Fatalf("Expected a stable ETag. Got '%s'", etag)
+	}
+
+	request, _ := http.NewRequest(http.MethodGet, server.URL+"/ipc-test/json", nil)
+	request.Header.Set("If-None-Match", `"other", W/`+etag)
+	request.Header.Set("Cache-Control", "no-cache")
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusNotModified || response.Header.Get("ETag") != etag {
+		t.Errorf("Expected 304 for a matching ETag. Got %d", response.StatusCode)
+	}
+	if !testSource.Last.NoCache {
+		t.Error("Expected Cache-Control: no-cache to skip the cache")
+	}
+
+	request.Header.Set("If-None-Match", `"other"`)
+	request.Header.Del("Cache-Control")
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || testSource.Last.NoCache {
+		t.Errorf("Expected 200 for a different ETag. Got %d", response.StatusCode)
+	}
+}
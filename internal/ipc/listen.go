@@ -0,0 +1,127 @@
+package ipc
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/plugins"
+)
+
+// Lambda environment variables for the addresses of the local servers
+const (
+	ListenAddress = "CACHE_EXTENSION_LISTEN_ADDRESS"
+	GrpcAddress   = "CACHE_EXTENSION_GRPC_ADDRESS"
+	RespAddress   = "CACHE_EXTENSION_RESP_ADDRESS"
+)
+
+// Default addresses, only reachable from the execution environment. The Redis protocol
+// listener is disabled by default
+const (
+	DefaultListenAddress = "127.0.0.1:4000"
+	DefaultGrpcAddress   = "127.0.0.1:4001"
+)
+
+// Prefix of addresses of Unix domain sockets, e.g. unix:/tmp/cache.sock
+const unixPrefix = "unix:"
+
+// Address disabling a server
+const disabledAddress = "off"
+
+// Addresses the servers listen on, "host:port" or "unix:<path>". Empty or "off" disables a server
+type Addresses struct {
+	Http string
+	Grpc string
+	Resp string
+}
+
+// A server and the address it listens on
+type server struct {
+	name     string
+	address  string
+	serve    func(net.Listener) error
+	listener net.Listener
+}
+
+// Servers bound by Bind, serving once Serve is called
+type Servers struct {
+	servers []*server
+}
+
+// Bind the servers without serving them yet, so the cache can be initialized first. Bind failures
+// and invalid settings are returned, in which case no server is bound. Clients must send the token
+// when one is configured
+func Bind(addresses Addresses) (*Servers, error) {
+	minBytes, err := loadCompressMinBytes()
+	if err != nil {
+		return nil, err
+	}
+	compressMinBytes = minBytes
+
+	enabled, err := loadAdminEnabled()
+	if err != nil {
+		return nil, err
+	}
+	adminEnabled = enabled
+
+	token, err := loadAuthToken()
+	if err != nil {
+		return nil, fmt.Errorf("could not write the token to %s: %w", os.Getenv(AuthTokenFile), err)
+	}
+	authToken = token
+
+	servers := []*server{
+		{name: "HTTP server", address: addresses.Http, serve: func(listener net.Listener) error {
+			return http.Serve(listener, newRouter())
+		}},
+		{name: "gRPC server", address: addresses.Grpc, serve: func(listener net.Listener) error {
+			return newGrpcServer().Serve(listener)
+		}},
+		{name: "Redis protocol listener", address: addresses.Resp, serve: serveResp},
+	}
+
+	var bound []*server
+	for _, s := range servers {
+		if s.address == "" || s.address == disabledAddress {
+			continue
+		}
+		listener, err := listen(s.address)
+		if err != nil {
+			for _, other := range bound {
+				other.listener.Close()
+			}
+			return nil, fmt.Errorf("%s could not listen on %s: %w", s.name, s.address, err)
+		}
+		s.listener = listener
+		bound = append(bound, s)
+	}
+	return &Servers{servers: bound}, nil
+}
+
+// Serve the bound servers in the background. Connections made since Bind wait until then
+func (s *Servers) Serve() {
+	for _, bound := range s.servers {
+		println(plugins.PrintPrefix, fmt.Sprintf("Starting %s on %s", bound.name, bound.address))
+		go func(bound *server) {
+			err := bound.serve(bound.listener)
+			println(plugins.PrintPrefix, fmt.Sprintf("%s stopped: %s", bound.name, err))
+		}(bound)
+	}
+}
+
+// Listen on a TCP address or a Unix domain socket. A socket left over by a previous run is removed
+func listen(address string) (net.Listener, error) {
+	if !strings.HasPrefix(address, unixPrefix) {
+		return net.Listen("tcp", address)
+	}
+
+	path := strings.TrimPrefix(address, unixPrefix)
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,81 @@
+package ipc
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBindUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "cache.sock")
+	// A socket left over by a previous run does not prevent listening
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	servers, err := Bind(Addresses{Http: unixPrefix + socket, Grpc: disabledAddress})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	servers.Serve()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	response, err := client.Get("http://localhost/ipc-test/plain")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer response.Body.Close()
+	if body, _ := io.ReadAll(response.Body); string(body) != "text" {
+		t.Errorf("Expected value over the socket. Got %s", body)
+	}
+}
+
+func TestBindBindFailure(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer busy.Close()
+
+	socket := filepath.Join(t.TempDir(), "cache.sock")
+	if _, err := Bind(Addresses{Http: unixPrefix + socket, Grpc: busy.Addr().String()}); err == nil {
+		t.Fatal("Expected an error for an address in use")
+	}
+	// The HTTP server bound before the failure is closed again
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("Expected socket of the HTTP server to be removed. Got %v", err)
+	}
+}
+
+func TestBindInvalidCompressMinBytes(t *testing.T) {
+	t.Setenv(CompressMinBytes, "1k")
+	socket := filepath.Join(t.TempDir(), "cache.sock")
+	if _, err := Bind(Addresses{Http: unixPrefix + socket, Grpc: disabledAddress}); err == nil {
+		t.Fatal("Expected an error for an invalid minimum size of compressed bodies")
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("Expected no server to be started. Got %v", err)
+	}
+}
+
+func TestBindInvalidAdmin(t *testing.T) {
+	t.Setenv(AdminEnabled, "yes please")
+	socket := filepath.Join(t.TempDir(), "cache.sock")
+	if _, err := Bind(Addresses{Http: unixPrefix + socket, Grpc: disabledAddress}); err == nil {
+		t.Fatal("Expected an error for an invalid " + AdminEnabled)
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("Expected no server to be bound. Got %v", err)
+	}
+}
@@ -0,0 +1,283 @@
+package ipc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Media types of the binary formats JSON values can be rendered in
+const (
+	MediaTypeMsgpack = "application/msgpack"
+	MediaTypeCbor    = "application/cbor"
+)
+
+// Lambda environment variable for the minimum size of response bodies which are compressed
+const CompressMinBytes = "CACHE_EXTENSION_COMPRESS_MIN_BYTES"
+
+// Bodies smaller than this are not worth compressing by default
+const defaultCompressMinBytes = 1024
+
+// Minimum size of compressed bodies, read from CACHE_EXTENSION_COMPRESS_MIN_BYTES by Bind
+var compressMinBytes = defaultCompressMinBytes
+
+// Returned when none of the formats of a value is accepted by the client
+var errNotAcceptable = errors.New("not acceptable")
+
+// Format a value can be rendered in
+type format struct {
+	// Content-Type of the rendered body
+	contentType string
+	// Media types of Accept matching the format
+	mediaTypes []string
+	render     func(value interface{}) ([]byte, error)
+}
+
+var (
+	msgpackFormat = format{
+		contentType: MediaTypeMsgpack,
+		mediaTypes:  []string{MediaTypeMsgpack, "application/x-msgpack", "application/vnd.msgpack"},
+		render:      msgpack.Marshal,
+	}
+	cborFormat = format{
+		contentType: MediaTypeCbor,
+		mediaTypes:  []string{MediaTypeCbor},
+		render:      cbor.Marshal,
+	}
+)
+
+// Encodings large bodies can be compressed with, in order of preference
+var encodings = []string{"zstd", "gzip"}
+
+// Media range of an Accept or Accept-Encoding header with its quality
+type acceptRange struct {
+	value   string
+	quality float64
+}
+
+// Render the data of a lookup in the format preferred by the Accept header. JSON values can be
+// rendered as JSON, MessagePack or CBOR, other values are only served as they are
+func render(data string, contentType string, accept string) ([]byte, string, error) {
+	if contentType == "" {
+		contentType = "text/plain; charset=utf-8"
+	}
+	original := format{contentType: contentType, mediaTypes: []string{mediaType(contentType)}}
+	offers := []format{original}
+	if isJson(contentType) {
+		offers = append(offers, msgpackFormat, cborFormat)
+	}
+
+	chosen, ok := negotiateFormat(parseAccept(accept), offers)
+	if !ok {
+		return nil, "", errNotAcceptable
+	}
+	if chosen.render == nil {
+		return []byte(data), chosen.contentType, nil
+	}
+
+	// Binary formats are rendered from the decoded JSON value
+	value, err := decodeJson(data)
+	if err != nil {
+		return nil, "", err
+	}
+	body, err := chosen.render(value)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, chosen.contentType, nil
+}
+
+// Choose the offer with the highest quality, earlier offers win ties. Without Accept header the
+// first offer is chosen
+func negotiateFormat(accepted []acceptRange, offers []format) (format, bool) {
+	if len(accepted) == 0 {
+		return offers[0], true
+	}
+
+	var chosen format
+	best := 0.0
+	for _, offer := range offers {
+		if quality := offerQuality(accepted, offer.mediaTypes); quality > best {
+			chosen, best = offer, quality
+		}
+	}
+	return chosen, best > 0
+}
+
+// Quality of the most specific media range matching one of the media types
+func offerQuality(accepted []acceptRange, mediaTypes []string) float64 {
+	quality, specificity := 0.0, -1
+	for _, accept := range accepted {
+		for _, mediaType := range mediaTypes {
+			match := -1
+			switch {
+			case accept.value == mediaType:
+				match = 2
+			case strings.HasSuffix(accept.value, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(accept.value, "*")):
+				match = 1
+			case accept.value == "*/*":
+				match = 0
+			}
+			if match > specificity {
+				quality, specificity = accept.quality, match
+			}
+		}
+	}
+	return quality
+}
+
+// Choose the encoding of a body, bodies smaller than CACHE_EXTENSION_COMPRESS_MIN_BYTES are not compressed
+func negotiateEncoding(acceptEncoding string, size int) string {
+	if size < compressMinBytes {
+		return ""
+	}
+
+	accepted := parseAccept(acceptEncoding)
+	chosen, best := "", 0.0
+	for _, encoding := range encodings {
+		quality, specificity := 0.0, -1
+		for _, accept := range accepted {
+			if accept.value == encoding && specificity < 1 {
+				quality, specificity = accept.quality, 1
+			} else if accept.value == "*" && specificity < 0 {
+				quality, specificity = accept.quality, 0
+			}
+		}
+		if quality > best {
+			chosen, best = encoding, quality
+		}
+	}
+	return chosen
+}
+
+// Compress a body with gzip or zstd
+func compress(body []byte, encoding string) ([]byte, error) {
+	var buffer bytes.Buffer
+	switch encoding {
+	case "gzip":
+		writer := gzip.NewWriter(&buffer)
+		if _, err := writer.Write(body); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+	case "zstd":
+		writer, err := zstd.NewWriter(&buffer)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := writer.Write(body); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return body, nil
+	}
+	return buffer.Bytes(), nil
+}
+
+// Parse an Accept or Accept-Encoding header, ranges are sorted by descending quality
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		value := strings.ToLower(strings.TrimSpace(fields[0]))
+		if value == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range fields[1:] {
+			name, q, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(name, "q") {
+				if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+					quality = parsed
+				}
+			}
+		}
+		ranges = append(ranges, acceptRange{value: value, quality: quality})
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].quality > ranges[j].quality })
+	return ranges
+}
+
+// Media type of a Content-Type without its parameters
+func mediaType(contentType string) string {
+	parsed, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(contentType)
+	}
+	return parsed
+}
+
+// Check whether a Content-Type is JSON, e.g. application/json or application/problem+json
+func isJson(contentType string) bool {
+	parsed := mediaType(contentType)
+	return parsed == "application/json" || strings.HasSuffix(parsed, "+json")
+}
+
+// Decode a JSON value, numbers are kept as integers when they fit
+func decodeJson(data string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return convertNumbers(value), nil
+}
+
+// Replace the json.Number values of a decoded value by integers or floats
+func convertNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = convertNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = convertNumbers(item)
+		}
+	case json.Number:
+		if number, err := v.Int64(); err == nil {
+			return number
+		}
+		if number, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return number
+		}
+		if number, err := v.Float64(); err == nil {
+			return number
+		}
+		return string(v)
+	}
+	return value
+}
+
+// Read CACHE_EXTENSION_COMPRESS_MIN_BYTES, a size which is not a non-negative number is an error
+func loadCompressMinBytes() (int, error) {
+	value := os.Getenv(CompressMinBytes)
+	if value == "" {
+		return defaultCompressMinBytes, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid %s env variable %s", CompressMinBytes, value)
+	}
+	return number, nil
+}
@@ -0,0 +1,137 @@
+package ipc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestRender(t *testing.T) {
+	data := `{"id":42,"price":9.5,"tags":["a"],"big":18446744073709551615}`
+
+	body, contentType, err := render(data, "application/json", "")
+	if err != nil || string(body) != data || contentType != "application/json" {
+		t.Errorf("Expected JSON as it is without Accept header. Got %s (%s), %v", body, contentType, err)
+	}
+
+	body, contentType, err = render(data, "application/json", "application/x-msgpack")
+	if err != nil || contentType != MediaTypeMsgpack {
+		t.Fatalf("Expected MessagePack. Got %s, %v", contentType, err)
+	}
+	var fromMsgpack map[string]interface{}
+	if err := msgpack.Unmarshal(body, &fromMsgpack); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if fromMsgpack["id"] != int64(42) || fromMsgpack["price"] != 9.5 || fromMsgpack["big"] != uint64(18446744073709551615) {
+		t.Errorf("Expected numbers to keep their type. Got %#v", fromMsgpack)
+	}
+
+	body, contentType, err = render(data, "application/json", "application/cbor;q=0.9, application/json;q=0.5")
+	if err != nil || contentType != MediaTypeCbor {
+		t.Fatalf("Expected CBOR. Got %s, %v", contentType, err)
+	}
+	var fromCbor map[string]interface{}
+	if err := cbor.Unmarshal(body, &fromCbor); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if fromCbor["id"] != uint64(42) || fromCbor["tags"].([]interface{})[0] != "a" {
+		t.Errorf("Expected CBOR of the JSON value. Got %#v", fromCbor)
+	}
+
+	if _, contentType, _ := render(data, "application/json", "text/html, */*;q=0.1"); contentType != "application/json" {
+		t.Errorf("Expected JSON for a wildcard. Got %s", contentType)
+	}
+	if _, _, err := render("plain", "", "application/msgpack"); err != errNotAcceptable {
+		t.Errorf("Expected text not to be rendered as MessagePack. Got %v", err)
+	}
+	if _, _, err := render(data, "application/json", "application/msgpack, */*;q=0"); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+// Compress bodies from a size on for the duration of a test
+func setCompressMinBytes(t *testing.T, size int) {
+	compressMinBytes = size
+	t.Cleanup(func() { compressMinBytes = defaultCompressMinBytes })
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	setCompressMinBytes(t, 10)
+
+	tests := []struct {
+		acceptEncoding string
+		size           int
+		encoding       string
+	}{
+		{"gzip, deflate, br", 100, "gzip"},
+		{"gzip, zstd", 100, "zstd"},
+		{"gzip;q=1, zstd;q=0.5", 100, "gzip"},
+		{"*", 100, "zstd"},
+		{"*, zstd;q=0", 100, "gzip"},
+		{"gzip", 5, ""},
+		{"", 100, ""},
+	}
+	for _, test := range tests {
+		if encoding := negotiateEncoding(test.acceptEncoding, test.size); encoding != test.encoding {
+			t.Errorf("%s: expected '%s'. Got '%s'", test.acceptEncoding, test.encoding, encoding)
+		}
+	}
+}
+
+func TestCompressedResponse(t *testing.T) {
+	setCompressMinBytes(t, 10)
+	value := `["` + strings.Repeat("x", 100) + `"]`
+	large := testSource.Results["json"]
+	large.Data = value
+	testSource.Results["large"] = large
+	defer delete(testSource.Results, "large")
+
+	server := httptest.NewServer(newRouter())
+	defer server.Close()
+
+	for _, encoding := range []string{"gzip", "zstd"} {
+		request, _ := http.NewRequest(http.MethodGet, server.URL+"/ipc-test/large", nil)
+		request.Header.Set("Accept-Encoding", encoding)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		compressed, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		if response.Header.Get("Content-Encoding") != encoding || !strings.HasSuffix(response.Header.Get("ETag"), "-"+encoding+`"`) {
+			t.Fatalf("Expected %s body. Got headers %v", encoding, response.Header)
+		}
+
+		var reader io.Reader
+		if encoding == "gzip" {
+			reader, err = gzip.NewReader(bytes.NewReader(compressed))
+		} else {
+			reader, err = zstd.NewReader(bytes.NewReader(compressed))
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if body, _ := io.ReadAll(reader); string(body) != value {
+			t.Errorf("Expected %s body to decompress to the value. Got %s", encoding, body)
+		}
+	}
+
+	request, _ := http.NewRequest(http.MethodGet, server.URL+"/ipc-test/plain", nil)
+	request.Header.Set("Accept", "application/cbor")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusNotAcceptable {
+		t.Errorf("Expected 406 for text rendered as CBOR. Got %d", response.StatusCode)
+	}
+}
@@ -0,0 +1,437 @@
+package ipc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/extension"
+	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/plugins"
+)
+
+// Limits of requests, larger ones close the connection. Lines hold an inline command or the
+// length of an argument
+const (
+	maxRespArgs      = 1024
+	maxRespArgBytes  = 64 * 1024
+	maxRespLineBytes = 64 * 1024
+)
+
+// Error replies of the Redis protocol
+var (
+	errRespProtocol = errors.New("ERR protocol error")
+	errRespSyntax   = errors.New("ERR syntax error")
+	errRespNoAuth   = errors.New("NOAUTH Authentication required.")
+)
+
+// Accept connections until the listener is closed
+func serveResp(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go handleRespConn(conn)
+	}
+}
+
+// Answer the commands of a connection until the client quits
+func handleRespConn(conn net.Conn) {
+	defer conn.Close()
+	// Lines must fit the buffer of the reader
+	reader := bufio.NewReaderSize(conn, maxRespLineBytes)
+	writer := bufio.NewWriter(conn)
+	authenticated := authToken == ""
+
+	for {
+		args, err := readRespCommand(reader)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				writeRespError(writer, errRespProtocol)
+				_ = writer.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		quit := strings.EqualFold(args[0], "QUIT")
+		switch {
+		case strings.EqualFold(args[0], "AUTH"):
+			authenticated = respAuth(writer, args) || authenticated
+		case !authenticated && !quit:
+			writeRespError(writer, errRespNoAuth)
+		default:
+			respCommand(writer, args)
+		}
+		// Pipelined commands are answered together
+		if reader.Buffered() == 0 || quit {
+			if err := writer.Flush(); err != nil || quit {
+				return
+			}
+		}
+	}
+}
+
+// Read a command, either an array of bulk strings or an inline command
+func readRespCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := readRespLine(reader)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+
+	count, err := strconv.Atoi(line[1:])
+	if err != nil || count < 0 || count > maxRespArgs {
+		return nil, errRespProtocol
+	}
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		line, err := readRespLine(reader)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, errRespProtocol
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxRespArgBytes {
+			return nil, errRespProtocol
+		}
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, arg); err != nil {
+			return nil, err
+		}
+		args = append(args, string(arg[:size]))
+	}
+	return args, nil
+}
+
+// Read a line without its CRLF, a line longer than the buffer of the reader is a protocol error
+func readRespLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return "", errRespProtocol
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// Answer a command
+func respCommand(w *bufio.Writer, args []string) {
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		if len(args) != 2 {
+			writeRespArityError(w, args[0])
+			return
+		}
+		value, err := respGet(args[1])
+		if err != nil {
+			writeRespError(w, err)
+			return
+		}
+		writeRespBulk(w, value)
+	case "MGET":
+		if len(args) < 2 {
+			writeRespArityError(w, args[0])
+			return
+		}
+		// Like Redis, a key which cannot be read is nil instead of failing the whole reply
+		values := make([]*string, 0, len(args)-1)
+		for _, key := range args[1:] {
+			value, err := respGet(key)
+			if err != nil {
+				println(plugins.PrintPrefix, fmt.Sprintf("Could not read '%s' for MGET: %s", key, err))
+			}
+			values = append(values, value)
+		}
+		fmt.Fprintf(w, "*%d\r\n", len(values))
+		for _, value := range values {
+			writeRespBulk(w, value)
+		}
+	case "DEL", "UNLINK":
+		if len(args) < 2 {
+			writeRespArityError(w, args[0])
+			return
+		}
+		deleted := 0
+		for _, key := range args[1:] {
+			cacheType, name := parseRespKey(key)
+			if _, ok := respPeek(cacheType, name); ok {
+				deleted++
+			}
+			_ = extension.InvalidateCache(cacheType, name)
+		}
+		writeRespInteger(w, int64(deleted))
+	case "EXISTS":
+		if len(args) < 2 {
+			writeRespArityError(w, args[0])
+			return
+		}
+		exists := 0
+		for _, key := range args[1:] {
+			if _, ok := respPeek(parseRespKey(key)); ok {
+				exists++
+			}
+		}
+		writeRespInteger(w, int64(exists))
+	case "TTL", "PTTL":
+		if len(args) != 2 {
+			writeRespArityError(w, args[0])
+			return
+		}
+		data, ok := respPeek(parseRespKey(args[1]))
+		switch {
+		case !ok:
+			writeRespInteger(w, -2)
+		case data.CacheExpiry.IsZero():
+			writeRespInteger(w, -1)
+		case strings.EqualFold(args[0], "PTTL"):
+			writeRespInteger(w, time.Until(data.CacheExpiry).Milliseconds())
+		default:
+			writeRespInteger(w, int64(math.Ceil(time.Until(data.CacheExpiry).Seconds())))
+		}
+	case "SCAN":
+		respScan(w, args[1:])
+	case "PING":
+		if len(args) > 1 {
+			writeRespBulk(w, &args[1])
+		} else {
+			w.WriteString("+PONG\r\n")
+		}
+	case "ECHO":
+		if len(args) != 2 {
+			writeRespArityError(w, args[0])
+			return
+		}
+		writeRespBulk(w, &args[1])
+	case "QUIT", "SELECT", "CLIENT", "READONLY":
+		// Accepted so that clients can connect with their default settings
+		w.WriteString("+OK\r\n")
+	case "COMMAND":
+		w.WriteString("*0\r\n")
+	default:
+		writeRespError(w, fmt.Errorf("ERR unknown command '%s'", args[0]))
+	}
+}
+
+// Check the token of AUTH [username] token, the username is ignored
+func respAuth(w *bufio.Writer, args []string) bool {
+	if len(args) != 2 && len(args) != 3 {
+		writeRespArityError(w, args[0])
+		return false
+	}
+	if authToken == "" {
+		writeRespError(w, errors.New("ERR AUTH called without any password configured"))
+		return false
+	}
+	if !validToken(args[len(args)-1]) {
+		writeRespError(w, errors.New("WRONGPASS invalid username-password pair"))
+		return false
+	}
+	w.WriteString("+OK\r\n")
+	return true
+}
+
+// Read a value, nil if it does not exist. Origin failures are returned as errors
+func respGet(key string) (*string, error) {
+	cacheType, name := parseRespKey(key)
+	result, err := extension.RouteCache(cacheType, plugins.CacheRequest{Name: name, Params: map[string]string{}})
+	if err != nil {
+		_, code := errorStatus(err)
+		if code == CodeNotFound || code == CodeUnknownCacheType {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ERR %s: %s", code, err)
+	}
+	return &result.Data, nil
+}
+
+// Return an entry if it is cached and has not expired
+func respPeek(cacheType string, name string) (plugins.CacheData, bool) {
+	data, ok := extension.PeekCache(cacheType, name)
+	if !ok || data.Data == "" || (!data.CacheExpiry.IsZero() && plugins.IsExpired(data.CacheExpiry)) {
+		return plugins.CacheData{}, false
+	}
+	return data, true
+}
+
+// Iterate over the cached keys of all sources: SCAN cursor [MATCH pattern] [COUNT count]. The
+// cursor is the position in the sorted list of keys
+func respScan(w *bufio.Writer, args []string) {
+	if len(args) == 0 {
+		writeRespArityError(w, "SCAN")
+		return
+	}
+	cursor, err := strconv.Atoi(args[0])
+	if err != nil || cursor < 0 {
+		writeRespError(w, errors.New("ERR invalid cursor"))
+		return
+	}
+
+	count := 10
+	var match *regexp.Regexp
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			writeRespError(w, errRespSyntax)
+			return
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			match = globRegexp(args[i+1])
+		case "COUNT":
+			count, err = strconv.Atoi(args[i+1])
+			if err != nil || count < 1 {
+				writeRespError(w, errRespSyntax)
+				return
+			}
+		default:
+			writeRespError(w, errRespSyntax)
+			return
+		}
+	}
+
+	keys := respKeys()
+	end := cursor + count
+	if end >= len(keys) {
+		end = len(keys)
+	}
+	var page []string
+	if cursor < end {
+		for _, key := range keys[cursor:end] {
+			if match == nil || match.MatchString(key) {
+				page = append(page, key)
+			}
+		}
+	}
+	next := 0
+	if end < len(keys) {
+		next = end
+	}
+
+	fmt.Fprintf(w, "*2\r\n")
+	nextCursor := strconv.Itoa(next)
+	writeRespBulk(w, &nextCursor)
+	fmt.Fprintf(w, "*%d\r\n", len(page))
+	for i := range page {
+		writeRespBulk(w, &page[i])
+	}
+}
+
+// Return the keys of all cached entries in the order of their cache type and name
+func respKeys() []string {
+	var keys []string
+	for _, cacheType := range plugins.SourceTypes() {
+		names, _ := extension.CacheKeys(cacheType, "")
+		for _, name := range names {
+			keys = append(keys, formatRespKey(cacheType, name))
+		}
+	}
+	return keys
+}
+
+// Split a key into cache type and name. DynamoDB keys are dynamodb:<table>:<hashKeyValue>[:<sortKeyValue>],
+// or dynamodb:<table>@@<hashKeyValue>[@@<sortKeyValue>] when the hash key value contains a colon.
+// Keys of other sources are <cacheType>:<name>
+func parseRespKey(key string) (string, string) {
+	cacheType, name, _ := strings.Cut(key, ":")
+	if cacheType == plugins.Dynamodb && !strings.Contains(name, "@@") {
+		name = strings.Join(strings.SplitN(name, ":", 3), "@@")
+	}
+	return cacheType, name
+}
+
+// Build the key of a cached entry, the inverse of parseRespKey
+func formatRespKey(cacheType string, name string) string {
+	if cacheType == plugins.Dynamodb {
+		parts := strings.Split(name, "@@")
+		colon := false
+		for _, part := range parts[:len(parts)-1] {
+			colon = colon || strings.Contains(part, ":")
+		}
+		if !colon {
+			name = strings.Join(parts, ":")
+		}
+	}
+	return cacheType + ":" + name
+}
+
+// Convert a glob pattern of MATCH to a regular expression. * and ? match any characters,
+// [...] a character class and \ escapes the next character
+func globRegexp(pattern string) *regexp.Regexp {
+	runes := []rune(pattern)
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '*':
+			expr.WriteString("(?s:.*)")
+		case '?':
+			expr.WriteString("(?s:.)")
+		case '[':
+			end := i + 1
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			if end == len(runes) {
+				expr.WriteString(`\[`)
+				continue
+			}
+			class := string(runes[i+1 : end])
+			negate := strings.HasPrefix(class, "^")
+			class = regexp.QuoteMeta(strings.TrimPrefix(class, "^"))
+			if negate {
+				class = "^" + class
+			}
+			expr.WriteString("[" + class + "]")
+			i = end
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+			}
+			expr.WriteString(regexp.QuoteMeta(string(runes[i])))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(runes[i])))
+		}
+	}
+	expr.WriteString("$")
+	match, err := regexp.Compile(expr.String())
+	if err != nil {
+		return regexp.MustCompile("^" + regexp.QuoteMeta(pattern) + "$")
+	}
+	return match
+}
+
+func writeRespBulk(w *bufio.Writer, value *string) {
+	if value == nil {
+		w.WriteString("$-1\r\n")
+		return
+	}
+	fmt.Fprintf(w, "$%d\r\n%s\r\n", len(*value), *value)
+}
+
+func writeRespInteger(w *bufio.Writer, value int64) {
+	fmt.Fprintf(w, ":%d\r\n", value)
+}
+
+// Error replies are single lines
+func writeRespError(w *bufio.Writer, err error) {
+	message := strings.NewReplacer("\r", " ", "\n", " ").Replace(err.Error())
+	fmt.Fprintf(w, "-%s\r\n", message)
+}
+
+func writeRespArityError(w *bufio.Writer, command string) {
+	writeRespError(w, fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command)))
+}
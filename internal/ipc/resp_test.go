@@ -0,0 +1,122 @@
+package ipc
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/plugins"
+)
+
+func TestRespCommands(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer listener.Close()
+	go serveResp(listener)
+
+	client := redis.NewClient(&redis.Options{Addr: listener.Addr().String()})
+	defer client.Close()
+	ctx := context.Background()
+
+	if value, err := client.Get(ctx, "ipc-test:json").Result(); err != nil || value != `{"a":1}` {
+		t.Errorf("Expected cached value. Got %s, %v", value, err)
+	}
+	if _, err := client.Get(ctx, "ipc-test:missing").Result(); err != redis.Nil {
+		t.Errorf("Expected nil for a missing value. Got %v", err)
+	}
+	if _, err := client.Get(ctx, "ipc-test:down").Result(); err == nil {
+		t.Error("Expected origin failure to be an error")
+	}
+	values, err := client.MGet(ctx, "ipc-test:json", "unknown:json", "ipc-test:plain", "ipc-test:down").Result()
+	if err != nil || len(values) != 4 || values[0] != `{"a":1}` || values[1] != nil || values[2] != "text" || values[3] != nil {
+		t.Errorf("Expected values and nil for missing and failing keys. Got %v, %v", values, err)
+	}
+
+	if n, err := client.Exists(ctx, "ipc-test:json", "ipc-test:missing").Result(); err != nil || n != 1 {
+		t.Errorf("Expected one cached key. Got %d, %v", n, err)
+	}
+	if ttl, err := client.TTL(ctx, "ipc-test:json").Result(); err != nil || ttl < time.Hour {
+		t.Errorf("Expected time to expiry. Got %s, %v", ttl, err)
+	}
+	if ttl, _ := client.TTL(ctx, "ipc-test:plain").Result(); ttl != -1 {
+		t.Errorf("Expected value without expiry. Got %s", ttl)
+	}
+	if ttl, _ := client.TTL(ctx, "ipc-test:missing").Result(); ttl != -2 {
+		t.Errorf("Expected missing key. Got %s", ttl)
+	}
+
+	keys, cursor, err := client.Scan(ctx, 0, "ipc-test:*", 1).Result()
+	if err != nil || len(keys) != 1 || keys[0] != "ipc-test:json" || cursor == 0 {
+		t.Errorf("Expected first page of keys. Got %v, %d, %v", keys, cursor, err)
+	}
+	var all []string
+	iter := client.Scan(ctx, 0, "ipc-test:p*", 0).Iterator()
+	for iter.Next(ctx) {
+		all = append(all, iter.Val())
+	}
+	if len(all) != 1 || all[0] != "ipc-test:plain" {
+		t.Errorf("Expected keys matching the pattern. Got %v", all)
+	}
+
+	if n, err := client.Del(ctx, "ipc-test:json", "ipc-test:missing").Result(); err != nil || n != 1 {
+		t.Errorf("Expected one deleted key. Got %d, %v", n, err)
+	}
+	if n := len(testSource.Invalidated); n < 2 || testSource.Invalidated[n-2] != "json" {
+		t.Errorf("Expected keys to be invalidated. Got %v", testSource.Invalidated)
+	}
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+func TestRespKey(t *testing.T) {
+	tests := []struct {
+		key       string
+		cacheType string
+		name      string
+	}{
+		{"dynamodb:users:42", plugins.Dynamodb, "users@@42"},
+		{"dynamodb:orders:a:2023-01-01T10:00", plugins.Dynamodb, "orders@@a@@2023-01-01T10:00"},
+		{"dynamodb:orders@@a:b@@1", plugins.Dynamodb, "orders@@a:b@@1"},
+		{"ssm:/app/db:host", "ssm", "/app/db:host"},
+	}
+	for _, test := range tests {
+		if cacheType, name := parseRespKey(test.key); cacheType != test.cacheType || name != test.name {
+			t.Errorf("%s: expected %s %s. Got %s %s", test.key, test.cacheType, test.name, cacheType, name)
+		}
+		if key := formatRespKey(test.cacheType, test.name); key != test.key {
+			t.Errorf("Expected key %s. Got %s", test.key, key)
+		}
+	}
+
+	for pattern, key := range map[string]string{"dynamodb:users:*": "dynamodb:users:42", "dynamodb:u?ers:[0-9]*": "dynamodb:users:42", `ssm:\*`: "ssm:*"} {
+		if !globRegexp(pattern).MatchString(key) {
+			t.Errorf("Expected %s to match %s", pattern, key)
+		}
+	}
+	if globRegexp("dynamodb:users:[^4]*").MatchString("dynamodb:users:42") {
+		t.Error("Expected negated class not to match")
+	}
+}
+
+func TestRespLineTooLong(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	go handleRespConn(server)
+
+	// An inline command without line end may not grow without bound
+	go func() {
+		_, _ = client.Write([]byte("GET " + strings.Repeat("x", maxRespLineBytes+1)))
+	}()
+	reply, err := bufio.NewReader(client).ReadString('\n')
+	if err != nil || reply != "-"+errRespProtocol.Error()+"\r\n" {
+		t.Errorf("Expected a protocol error. Got %q, %v", reply, err)
+	}
+}
@@ -0,0 +1,274 @@
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/appconfigdata"
+	"github.com/aws/aws-sdk-go/service/appconfigdata/appconfigdataiface"
+)
+
+// Cache type of AWS AppConfig
+const AppConfig = "appconfig"
+
+// Struct to store AWS AppConfig cache configuration of a configuration profile
+type AppConfigConfiguration struct {
+	Application     string `yaml:"application"`
+	Environment     string `yaml:"environment"`
+	Profile         string `yaml:"profile"`
+	MinPollInterval string `yaml:"minPollInterval"`
+
+	// Region, endpoint and credentials used for this profile
+	AwsConfiguration `yaml:",inline"`
+
+	minPollInterval time.Duration
+}
+
+// Name of a configuration profile in lookups, "application/environment/profile"
+func (c AppConfigConfiguration) Name() string {
+	return c.Application + "/" + c.Environment + "/" + c.Profile
+}
+
+// Last good configuration of a profile, kept up to date by a poller
+type appConfigProfile struct {
+	config      AppConfigConfiguration
+	mu          sync.RWMutex
+	data        CacheData
+	contentType string
+	// Closed once the first poll finished, successful or not
+	loaded     chan struct{}
+	loadedOnce sync.Once
+}
+
+// Source serving configuration profiles of AWS AppConfig
+type appConfigSource struct {
+	profiles map[string]*appConfigProfile
+	// Counters of the profiles, the configurations themselves are kept by their pollers
+	cache *cacheStore
+	// Closed to stop the pollers started by the last Init
+	stopPollers chan struct{}
+}
+
+var (
+	appConfigClients = newClientCache[AwsConfiguration](func(sess *session.Session, _ AwsConfiguration) appconfigdataiface.AppConfigDataAPI {
+		return appconfigdata.New(sess)
+	})
+)
+
+func init() {
+	RegisterSource(AppConfig, newAppConfigSource())
+}
+
+func newAppConfigSource() *appConfigSource {
+	return &appConfigSource{profiles: make(map[string]*appConfigProfile), cache: newCacheStore()}
+}
+
+// Initialize the profiles listed in the appconfig section of cache.yaml and start polling them
+func (s *appConfigSource) Init(unmarshal func(interface{}) error) error {
+	var configs []AppConfigConfiguration
+	if err := unmarshal(&configs); err != nil {
+		return err
+	}
+
+	if s.stopPollers != nil {
+		close(s.stopPollers)
+	}
+	s.stopPollers = make(chan struct{})
+	s.profiles = make(map[string]*appConfigProfile, len(configs))
+
+	for _, config := range configs {
+		if config.Application == "" || config.Environment == "" || config.Profile == "" {
+			return fmt.Errorf("application, environment and profile are required for appconfig profiles")
+		}
+
+		interval, err := ParseTtl(config.MinPollInterval)
+		if err != nil {
+			return fmt.Errorf("appconfig profile %s: minPollInterval: %w", config.Name(), err)
+		}
+		config.minPollInterval = interval
+
+		profile := newAppConfigProfile(config)
+		s.profiles[config.Name()] = profile
+		go s.poll(profile, s.stopPollers)
+	}
+	return nil
+}
+
+func newAppConfigProfile(config AppConfigConfiguration) *appConfigProfile {
+	return &appConfigProfile{config: config, loaded: make(chan struct{})}
+}
+
+// Wait until the first poll of every profile finished
+func (s *appConfigSource) Preload() error {
+	var failed []string
+	for name := range s.profiles {
+		if _, err := s.Fetch(CacheRequest{Name: name}); err != nil {
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not load appconfig profiles %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Fetch the last good configuration of a profile with its original content type
+func (s *appConfigSource) Fetch(request CacheRequest) (CacheResult, error) {
+	profile, ok := s.profiles[request.Name]
+	if !ok {
+		return CacheResult{}, fmt.Errorf("%w: no appconfig configuration for profile '%s'", ErrNotFound, request.Name)
+	}
+
+	// A lookup right after startup waits for the first poll
+	stats := s.cache.Stats(request.Name)
+	waited := false
+	select {
+	case <-profile.loaded:
+	default:
+		waited = true
+		atomic.AddUint64(&stats.Misses, 1)
+		ctx, cancel := OriginContext()
+		defer cancel()
+		select {
+		case <-profile.loaded:
+		case <-ctx.Done():
+			return CacheResult{}, fmt.Errorf("%w: first poll of appconfig profile '%s'", ErrOriginTimeout, request.Name)
+		}
+	}
+
+	profile.mu.RLock()
+	defer profile.mu.RUnlock()
+	if profile.data.Data == "" {
+		if !waited {
+			atomic.AddUint64(&stats.Misses, 1)
+		}
+		return CacheResult{}, fmt.Errorf("%w: appconfig profile '%s' could not be loaded", ErrOriginUnavailable, request.Name)
+	}
+	if waited {
+		result := profile.data.Result(request.Name, CacheMiss, TierOrigin)
+		result.ContentType = profile.contentType
+		return result, nil
+	}
+
+	// Profiles are refreshed by polling only, so a lookup is served from memory afterwards
+	atomic.AddUint64(&stats.Hits, 1)
+	result := profile.data.Result(request.Name, CacheHit, TierMemory)
+	result.ContentType = profile.contentType
+	return result, nil
+}
+
+// Configuration is refreshed by polling only, so there is nothing to invalidate
+func (s *appConfigSource) Invalidate(name string) {}
+
+func (s *appConfigSource) Stats() map[string]CacheStats {
+	return s.cache.StatsSnapshot()
+}
+
+// Poll a profile at the interval suggested by AppConfig until the source is initialized again
+func (s *appConfigSource) poll(profile *appConfigProfile, stop <-chan struct{}) {
+	token := ""
+	breaker := GetCircuitBreaker(AppConfig + ":" + profile.config.Name())
+	for {
+		// Polls are skipped while the breaker of the profile is open
+		interval := pollRetryInterval(profile.config)
+		err := breaker.Call(func() error {
+			var err error
+			interval, err = s.pollOnce(profile, &token)
+			return err
+		})
+		if err != nil {
+			atomic.AddUint64(&s.cache.Stats(profile.config.Name()).OriginErrors, 1)
+			println(PrintPrefix, fmt.Sprintf("Error polling appconfig profile %s, keeping last configuration: %s",
+				profile.config.Name(), err))
+		}
+		profile.loadedOnce.Do(func() { close(profile.loaded) })
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Get the latest configuration of a profile, starting a new session when there is no valid token.
+// Returns the time to wait before the next poll
+func (s *appConfigSource) pollOnce(profile *appConfigProfile, token *string) (time.Duration, error) {
+	config := profile.config
+	retryInterval := pollRetryInterval(config)
+
+	client, err := GetAppConfigClient(config.AwsConfiguration)
+	if err != nil {
+		return retryInterval, err
+	}
+
+	ctx, cancel := OriginContext()
+	defer cancel()
+
+	if *token == "" {
+		input := &appconfigdata.StartConfigurationSessionInput{
+			ApplicationIdentifier:          aws.String(config.Application),
+			EnvironmentIdentifier:          aws.String(config.Environment),
+			ConfigurationProfileIdentifier: aws.String(config.Profile),
+		}
+		if config.minPollInterval > 0 {
+			input.RequiredMinimumPollIntervalInSeconds = aws.Int64(int64(config.minPollInterval.Seconds()))
+		}
+		session, err := client.StartConfigurationSessionWithContext(ctx, input)
+		if err != nil {
+			return retryInterval, err
+		}
+		*token = aws.StringValue(session.InitialConfigurationToken)
+	}
+
+	result, err := client.GetLatestConfigurationWithContext(ctx, &appconfigdata.GetLatestConfigurationInput{
+		ConfigurationToken: aws.String(*token),
+	})
+	if err != nil {
+		// Tokens expire after 24 hours or when used twice, a new session is needed
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == appconfigdata.ErrCodeBadRequestException {
+			*token = ""
+		}
+		return retryInterval, err
+	}
+	*token = aws.StringValue(result.NextPollConfigurationToken)
+
+	// An empty configuration means it did not change since the last poll
+	if len(result.Configuration) > 0 {
+		profile.mu.Lock()
+		profile.data = CacheData{Data: string(result.Configuration), FetchedAt: time.Now()}
+		profile.contentType = aws.StringValue(result.ContentType)
+		profile.mu.Unlock()
+		println(PrintPrefix, fmt.Sprintf("Loaded appconfig profile %s version %s",
+			config.Name(), aws.StringValue(result.VersionLabel)))
+	}
+
+	interval := time.Duration(aws.Int64Value(result.NextPollIntervalInSeconds)) * time.Second
+	if interval <= 0 {
+		interval = retryInterval
+	}
+	return interval, nil
+}
+
+// Time to wait before polling again after a failed poll
+func pollRetryInterval(config AppConfigConfiguration) time.Duration {
+	if config.minPollInterval < 15*time.Second {
+		return 15 * time.Second
+	}
+	return config.minPollInterval
+}
+
+// Get the AppConfig Data client for a region, endpoint and role, created on first use
+func GetAppConfigClient(config AwsConfiguration) (appconfigdataiface.AppConfigDataAPI, error) {
+	return appConfigClients.get(config, config)
+}
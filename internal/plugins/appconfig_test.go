@@ -0,0 +1,130 @@
+package plugins
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/appconfigdata"
+	"github.com/aws/aws-sdk-go/service/appconfigdata/appconfigdataiface"
+	"gopkg.in/yaml.v2"
+)
+
+type fakeAppConfigClient struct {
+	appconfigdataiface.AppConfigDataAPI
+	sessions      int
+	configuration []string
+	fail          bool
+}
+
+func (f *fakeAppConfigClient) StartConfigurationSessionWithContext(aws.Context, *appconfigdata.StartConfigurationSessionInput, ...request.Option) (*appconfigdata.StartConfigurationSessionOutput, error) {
+	f.sessions++
+	return &appconfigdata.StartConfigurationSessionOutput{InitialConfigurationToken: aws.String("initial")}, nil
+}
+
+func (f *fakeAppConfigClient) GetLatestConfigurationWithContext(aws.Context, *appconfigdata.GetLatestConfigurationInput, ...request.Option) (*appconfigdata.GetLatestConfigurationOutput, error) {
+	if f.fail {
+		return nil, awserr.NewRequestFailure(awserr.New(appconfigdata.ErrCodeInternalServerException, "unavailable", nil), 500, "")
+	}
+	output := &appconfigdata.GetLatestConfigurationOutput{
+		ContentType:                aws.String("application/json"),
+		NextPollConfigurationToken: aws.String("next"),
+		NextPollIntervalInSeconds:  aws.Int64(30),
+	}
+	if len(f.configuration) > 0 {
+		output.Configuration = []byte(f.configuration[0])
+		f.configuration = f.configuration[1:]
+	}
+	return output, nil
+}
+
+func TestAppConfigPoll(t *testing.T) {
+	client := &fakeAppConfigClient{configuration: []string{`{"beta":true}`}}
+	appConfigClients.set(AwsConfiguration{}, client)
+	defer appConfigClients.delete(AwsConfiguration{})
+
+	profile := newAppConfigProfile(AppConfigConfiguration{Application: "app", Environment: "prod", Profile: "flags"})
+	source := newAppConfigSource()
+	source.profiles["app/prod/flags"] = profile
+	close(profile.loaded)
+
+	token := ""
+	interval, err := source.pollOnce(profile, &token)
+	if err != nil || interval != 30*time.Second || token != "next" {
+		t.Fatalf("Unexpected poll result %s, %s, %s", interval, err, token)
+	}
+
+	// Unchanged and failed polls keep the last good configuration
+	if _, err := source.pollOnce(profile, &token); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	client.fail = true
+	if _, err := source.pollOnce(profile, &token); err == nil {
+		t.Fatal("Expected poll to fail")
+	}
+
+	result, err := source.Fetch(CacheRequest{Name: "app/prod/flags"})
+	if err != nil || result.Data != `{"beta":true}` || result.ContentType != "application/json" {
+		t.Errorf("Expected last good configuration. Got %+v", result)
+	}
+	if client.sessions != 1 {
+		t.Errorf("Expected a single session. Got %d", client.sessions)
+	}
+	if stats := source.Stats()["app/prod/flags"]; stats.Hits != 1 || stats.Misses != 0 {
+		t.Errorf("Expected the lookup to count as hit. Got %+v", stats)
+	}
+}
+
+func TestAppConfigFirstPoll(t *testing.T) {
+	t.Setenv(CircuitBreakerThreshold, "1")
+	defer delete(circuitBreakers, AppConfig+":app/prod/broken")
+	appConfigClients.set(AwsConfiguration{}, &fakeAppConfigClient{fail: true})
+	defer appConfigClients.delete(AwsConfiguration{})
+
+	source := newAppConfigSource()
+	config := "- application: app\n  environment: prod\n  profile: broken\n"
+	if err := source.Init(func(v interface{}) error { return yaml.Unmarshal([]byte(config), v) }); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer close(source.stopPollers)
+
+	// The lookup waits for the first poll, which fails
+	if _, err := source.Fetch(CacheRequest{Name: "app/prod/broken"}); !errors.Is(err, ErrOriginUnavailable) {
+		t.Errorf("Expected the profile to be unavailable. Got %v", err)
+	}
+	if stats := source.Stats()["app/prod/broken"]; stats.Misses != 1 || stats.OriginErrors != 1 {
+		t.Errorf("Expected a miss and an origin error. Got %+v", stats)
+	}
+	if !GetCircuitBreaker(AppConfig + ":app/prod/broken").IsOpen() {
+		t.Error("Expected the failed poll to open the circuit breaker of the profile")
+	}
+}
+
+func TestAppConfigReinit(t *testing.T) {
+	appConfigClients.set(AwsConfiguration{}, &fakeAppConfigClient{configuration: []string{`{"beta":true}`}})
+	defer appConfigClients.delete(AwsConfiguration{})
+
+	source := newAppConfigSource()
+	config := "- application: app\n  environment: prod\n  profile: flags\n"
+	if err := source.Init(func(v interface{}) error { return yaml.Unmarshal([]byte(config), v) }); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	<-source.profiles["app/prod/flags"].loaded
+	first := source.stopPollers
+
+	if err := source.Init(func(v interface{}) error { return yaml.Unmarshal([]byte("[]"), v) }); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	select {
+	case <-first:
+	default:
+		t.Error("Expected the pollers of the previous configuration to be stopped")
+	}
+	if _, ok := source.profiles["app/prod/flags"]; ok {
+		t.Error("Expected the previous configuration to be replaced")
+	}
+	close(source.stopPollers)
+}
@@ -0,0 +1,151 @@
+package plugins
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"golang.org/x/sync/singleflight"
+)
+
+// Struct to store where and as whom an AWS service is called. Empty fields fall back to the
+// Lambda execution environment
+type AwsConfiguration struct {
+	Region     string `yaml:"region"`
+	Endpoint   string `yaml:"endpoint"`
+	RoleArn    string `yaml:"roleArn"`
+	ExternalId string `yaml:"externalId"`
+}
+
+var (
+	defaultSession    *session.Session
+	defaultSessionErr error
+	defaultSessionMu  sync.Mutex
+)
+
+// Get the session of the Lambda execution environment, created on first use
+func GetDefaultSession() (*session.Session, error) {
+	defaultSessionMu.Lock()
+	defer defaultSessionMu.Unlock()
+
+	if defaultSession == nil && defaultSessionErr == nil {
+		defaultSession, defaultSessionErr = session.NewSessionWithOptions(session.Options{
+			SharedConfigState: session.SharedConfigEnable,
+		})
+	}
+	return defaultSession, defaultSessionErr
+}
+
+// Create a session for the given region, endpoint and assumed role. Credentials are resolved
+// eagerly within the origin timeout so a failing role is reported when the session is created
+func NewAwsSession(config AwsConfiguration) (*session.Session, error) {
+	sess, err := GetDefaultSession()
+	if err != nil {
+		return nil, fmt.Errorf("could not create AWS session: %w", err)
+	}
+
+	awsConfig := OriginConfig()
+	if config.Region != "" {
+		awsConfig.WithRegion(config.Region)
+	}
+	if config.Endpoint != "" {
+		awsConfig.WithEndpoint(config.Endpoint)
+	}
+	if config.RoleArn != "" {
+		awsConfig.WithCredentials(stscreds.NewCredentials(sess, config.RoleArn, func(provider *stscreds.AssumeRoleProvider) {
+			if config.ExternalId != "" {
+				provider.ExternalID = aws.String(config.ExternalId)
+			}
+		}))
+	}
+
+	sess = sess.Copy(awsConfig)
+	ctx, cancel := OriginContext()
+	defer cancel()
+	if _, err := sess.Config.Credentials.GetWithContext(ctx); err != nil {
+		return nil, fmt.Errorf("could not resolve AWS credentials: %w", err)
+	}
+	return sess, nil
+}
+
+// How long a client which could not be created is not retried
+const clientRetryDelay = 5 * time.Second
+
+// Error of creating a client and until when it is returned without trying again
+type clientFailure struct {
+	err   error
+	until time.Time
+}
+
+// Clients of an AWS service by key, created on first use. Assuming a role calls STS, so sessions
+// are created outside the lock, one per key at a time, and lookups of other keys are not blocked
+type clientCache[K comparable, C any] struct {
+	mu      sync.Mutex
+	clients map[K]C
+	// Clients which could not be created, not retried before their time passed
+	failures  map[K]clientFailure
+	group     singleflight.Group
+	newClient func(sess *session.Session, config AwsConfiguration) C
+}
+
+func newClientCache[K comparable, C any](newClient func(sess *session.Session, config AwsConfiguration) C) *clientCache[K, C] {
+	return &clientCache[K, C]{
+		clients:   make(map[K]C),
+		failures:  make(map[K]clientFailure),
+		newClient: newClient,
+	}
+}
+
+// Get the client of a key, created with the region, endpoint and role of the configuration
+func (c *clientCache[K, C]) get(key K, config AwsConfiguration) (C, error) {
+	var none C
+	c.mu.Lock()
+	if client, ok := c.clients[key]; ok {
+		c.mu.Unlock()
+		return client, nil
+	}
+	if failure, ok := c.failures[key]; ok && time.Now().Before(failure.until) {
+		c.mu.Unlock()
+		return none, failure.err
+	}
+	c.mu.Unlock()
+
+	client, err, _ := c.group.Do(fmt.Sprint(key), func() (interface{}, error) {
+		sess, err := NewAwsSession(config)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if err != nil {
+			// A failed session is kept briefly so lookups do not call STS again and again
+			c.failures[key] = clientFailure{err: err, until: time.Now().Add(clientRetryDelay)}
+			return nil, err
+		}
+		delete(c.failures, key)
+
+		client := c.newClient(sess, config)
+		c.clients[key] = client
+		return client, nil
+	})
+	if err != nil {
+		return none, err
+	}
+	return client.(C), nil
+}
+
+// Use a client for a key instead of creating one
+func (c *clientCache[K, C]) set(key K, client C) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clients[key] = client
+}
+
+// Forget the client of a key, it is created again on its next use
+func (c *clientCache[K, C]) delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.clients, key)
+	delete(c.failures, key)
+}
@@ -0,0 +1,174 @@
+package plugins
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// In-memory cache shared by the sources. It expires entries, serves stale data while the origin
+// is unavailable and coalesces concurrent origin calls for the same key
+type cacheStore struct {
+	mu      sync.RWMutex
+	entries map[string]CacheData
+	stats   map[string]*CacheStats
+	group   singleflight.Group
+}
+
+func newCacheStore() *cacheStore {
+	return &cacheStore{
+		entries: make(map[string]CacheData),
+		stats:   make(map[string]*CacheStats),
+	}
+}
+
+// Get an entry from the cache, expired or not
+func (c *cacheStore) Get(key string) (CacheData, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	data, ok := c.entries[key]
+	return data, ok
+}
+
+// Add an entry to the cache
+func (c *cacheStore) Set(key string, data CacheData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = data
+}
+
+// Remove an entry from the cache
+func (c *cacheStore) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// Remove the entry of a name and the entries of the name with parameters, keyed "name?params"
+func (c *cacheStore) DeleteWithParams(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, name)
+	for key := range c.entries {
+		if strings.HasPrefix(key, name+"?") {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Return all keys in the cache in alphabetical order
+func (c *cacheStore) Keys() []string {
+	return c.KeysWithPrefix("")
+}
+
+// Return the keys starting with a prefix in alphabetical order
+func (c *cacheStore) KeysWithPrefix(prefix string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Get the counters of a group of entries, created on first use
+func (c *cacheStore) Stats(group string) *CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats, ok := c.stats[group]
+	if !ok {
+		stats = &CacheStats{}
+		c.stats[group] = stats
+	}
+	return stats
+}
+
+// Return a copy of the counters of all groups
+func (c *cacheStore) StatsSnapshot() map[string]CacheStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	stats := make(map[string]CacheStats, len(c.stats))
+	for group, groupStats := range c.stats {
+		stats[group] = groupStats.Snapshot()
+	}
+	return stats
+}
+
+// Read an entry from the cache or, when missing or expired, load it from the origin guarded by
+// the origin's circuit breaker. The loader gets the cached copy for conditional requests and
+// returns false if the data does not exist. A bypass loads the data even if it has not expired
+func (c *cacheStore) Fetch(key string, group string, origin string, bypass bool, load func(cached CacheData) (CacheData, bool, error)) (CacheResult, error) {
+	cached, _ := c.Get(key)
+	if cached.Data != "" && !IsExpired(cached.CacheExpiry) && !bypass {
+		atomic.AddUint64(&c.Stats(group).Hits, 1)
+		return cached.Result(key, CacheHit, TierMemory), nil
+	}
+	if !bypass {
+		atomic.AddUint64(&c.Stats(group).Misses, 1)
+	}
+
+	// Concurrent lookups of the same key share a single origin call
+	value, err, _ := c.group.Do(key, func() (interface{}, error) {
+		var data CacheData
+		var found bool
+		err := GetCircuitBreaker(origin).Call(func() error {
+			var err error
+			data, found, err = load(cached)
+			return err
+		})
+		if err != nil {
+			return CacheData{}, err
+		}
+
+		if !found {
+			c.Delete(key)
+			return CacheData{}, nil
+		}
+		if data.FetchedAt.IsZero() {
+			data.FetchedAt = time.Now()
+		}
+		if data.NoStore {
+			c.Delete(key)
+		} else {
+			c.Set(key, data)
+		}
+		return data, nil
+	})
+
+	if err != nil {
+		println(PrintPrefix, PrettyPrint(err.Error()))
+		stats := c.Stats(group)
+		atomic.AddUint64(&stats.OriginErrors, 1)
+
+		// Serve the expired copy within the maximum staleness while the origin is unavailable
+		if isStaleServable(err) && CanServeStale(cached) {
+			served := atomic.AddUint64(&stats.StaleServed, 1)
+			println(PrintPrefix, fmt.Sprintf("Serving stale data for '%s' while %s is unavailable (%d stale responses for %s)",
+				key, origin, served, group))
+			return cached.Result(key, CacheStale, TierMemory), nil
+		}
+		return CacheResult{}, originError(err)
+	}
+
+	data := value.(CacheData)
+	if data.Data == "" {
+		return CacheResult{}, fmt.Errorf("%w: '%s'", ErrNotFound, key)
+	}
+	status := CacheMiss
+	if bypass {
+		status = CacheBypass
+	}
+	return data.Result(key, status, TierOrigin), nil
+}
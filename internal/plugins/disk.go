@@ -0,0 +1,209 @@
+package plugins
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Lambda environment variables configuring the memory limit of the cache and the disk tier in
+// ephemeral storage which receives the entries evicted from memory
+const (
+	MemoryMaxBytes = "CACHE_EXTENSION_MEMORY_MAX_BYTES"
+	DiskCachePath  = "CACHE_EXTENSION_DISK_PATH"
+)
+
+// Bucket of the Dynamodb items in the disk tier
+var dynamoDbBucket = []byte(Dynamodb)
+
+var (
+	diskCache     *bolt.DB
+	diskCacheOnce sync.Once
+)
+
+// Entry of the disk tier. Besides the data only the key of the item is written, the rest of its
+// configuration, including credentials, is taken from the table configuration when it is read
+type diskEntry struct {
+	Data         CacheData
+	Table        string
+	HashKeyValue string `json:",omitempty"`
+	SortKeyValue string `json:",omitempty"`
+}
+
+func newDiskEntry(dbCache DynamoDbCache) diskEntry {
+	return diskEntry{
+		Data:         dbCache.Data,
+		Table:        dbCache.Config.Table,
+		HashKeyValue: dbCache.Config.HashKeyValue,
+		SortKeyValue: dbCache.Config.SortKeyValue,
+	}
+}
+
+// Rebuild the cache entry with the current configuration of its table
+func (e diskEntry) cache() DynamoDbCache {
+	config, ok := initializedConfig[e.Table]
+	if !ok {
+		config = DynamoDbConfiguration{Table: e.Table}
+	}
+	config.HashKeyValue = e.HashKeyValue
+	config.SortKeyValue = e.SortKeyValue
+	return DynamoDbCache{Data: e.Data, Config: config}
+}
+
+// Get the disk tier, nil if it is not configured or could not be opened
+func getDiskCache() *bolt.DB {
+	diskCacheOnce.Do(func() {
+		path := os.Getenv(DiskCachePath)
+		if path == "" {
+			return
+		}
+
+		// Entries of a previous execution environment are outdated
+		_ = os.Remove(path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			println(PrintPrefix, fmt.Sprintf("Disk cache disabled, could not create %s: %s", filepath.Dir(path), err))
+			return
+		}
+
+		// The file does not outlive the execution environment, so writes are not synced
+		db, err := bolt.Open(path, 0o600, &bolt.Options{NoSync: true, NoFreelistSync: true})
+		if err != nil {
+			println(PrintPrefix, fmt.Sprintf("Disk cache disabled, could not open %s: %s", path, err))
+			return
+		}
+		err = db.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(dynamoDbBucket)
+			return err
+		})
+		if err != nil {
+			println(PrintPrefix, fmt.Sprintf("Disk cache disabled, could not initialize %s: %s", path, err))
+			_ = db.Close()
+			return
+		}
+
+		println(PrintPrefix, "Using disk cache at "+path)
+		diskCache = db
+	})
+	return diskCache
+}
+
+// Read an entry from the disk tier
+func getDiskEntry(name string) (DynamoDbCache, bool) {
+	db := getDiskCache()
+	if db == nil {
+		return DynamoDbCache{}, false
+	}
+
+	var value []byte
+	_ = db.View(func(tx *bolt.Tx) error {
+		// The value is only valid during the transaction
+		value = append(value, tx.Bucket(dynamoDbBucket).Get([]byte(name))...)
+		return nil
+	})
+	if len(value) == 0 {
+		return DynamoDbCache{}, false
+	}
+
+	var entry diskEntry
+	if err := json.Unmarshal(value, &entry); err != nil {
+		println(PrintPrefix, fmt.Sprintf("Invalid entry '%s' in disk cache: %s", name, err))
+		return DynamoDbCache{}, false
+	}
+	return entry.cache(), true
+}
+
+// Write entries evicted from memory to the disk tier in a single transaction, returns false
+// if they could not be written
+func putDiskEntries(entries []*dynamoDbCacheEntry) bool {
+	db := getDiskCache()
+	if db == nil || len(entries) == 0 {
+		return false
+	}
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(dynamoDbBucket)
+		for _, entry := range entries {
+			value, err := json.Marshal(newDiskEntry(entry.cache))
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(entry.name), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		println(PrintPrefix, fmt.Sprintf("Error writing %d entries to disk cache: %s", len(entries), err))
+		return false
+	}
+	return true
+}
+
+// Remove an entry from the disk tier
+func deleteDiskEntry(name string) {
+	db := getDiskCache()
+	if db == nil {
+		return
+	}
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(dynamoDbBucket).Delete([]byte(name))
+	})
+	if err != nil {
+		println(PrintPrefix, fmt.Sprintf("Error removing '%s' from disk cache: %s", name, err))
+	}
+}
+
+// Close the disk tier, called when the extension shuts down
+func CloseDiskCache() {
+	if diskCache != nil {
+		_ = diskCache.Close()
+	}
+}
+
+// Call fn for every entry of the disk tier whose name starts with a prefix
+func forEachDiskEntry(prefix string, fn func(name string, dbCache DynamoDbCache)) {
+	db := getDiskCache()
+	if db == nil {
+		return
+	}
+
+	err := db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(dynamoDbBucket).Cursor()
+		for key, value := cursor.Seek([]byte(prefix)); key != nil && bytes.HasPrefix(key, []byte(prefix)); key, value = cursor.Next() {
+			var entry diskEntry
+			if err := json.Unmarshal(value, &entry); err != nil {
+				continue
+			}
+			fn(string(key), entry.cache())
+		}
+		return nil
+	})
+	if err != nil {
+		println(PrintPrefix, fmt.Sprintf("Error reading disk cache: %s", err))
+	}
+}
+
+// Call fn for the name of every entry of the disk tier, the entries are not decoded
+func forEachDiskName(fn func(name string)) {
+	db := getDiskCache()
+	if db == nil {
+		return
+	}
+
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(dynamoDbBucket).ForEach(func(key, _ []byte) error {
+			fn(string(key))
+			return nil
+		})
+	})
+	if err != nil {
+		println(PrintPrefix, fmt.Sprintf("Error reading disk cache: %s", err))
+	}
+}
@@ -0,0 +1,117 @@
+package plugins
+
+import (
+	"container/list"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestDiskSpillover(t *testing.T) {
+	t.Setenv(MemoryMaxBytes, "100")
+	t.Setenv(DiskCachePath, filepath.Join(t.TempDir(), "cache", "dynamodb.db"))
+	diskCache, diskCacheOnce = nil, sync.Once{}
+	dynamoDbCache, dynamoDbLru, dynamoDbCacheBytes = make(map[string]*list.Element), list.New(), 0
+	defer func() {
+		CloseDiskCache()
+		diskCache, diskCacheOnce = nil, sync.Once{}
+		dynamoDbCache, dynamoDbLru, dynamoDbCacheBytes = make(map[string]*list.Element), list.New(), 0
+		delete(dynamoDbStats, "spill")
+	}()
+
+	entry := func(value string) DynamoDbCache {
+		return DynamoDbCache{
+			Data:   CacheData{Data: value, CacheExpiry: time.Now().Add(time.Minute)},
+			Config: DynamoDbConfiguration{Table: "spill", HashKeyValue: value[:1]},
+		}
+	}
+	setDynamoDbCache("spill@@a", entry("a"+strings.Repeat("1", 39)))
+	setDynamoDbCache("spill@@b", entry("b"+strings.Repeat("2", 39)))
+	// Reading a keeps it in memory, so b is the least recently used entry
+	getDynamoDbCache("spill@@a")
+	setDynamoDbCache("spill@@c", entry("c"+strings.Repeat("3", 39)))
+
+	if _, ok := dynamoDbCache["spill@@b"]; ok || dynamoDbCacheBytes > 100 {
+		t.Fatalf("Expected b to be evicted from memory. Got %d bytes in memory", dynamoDbCacheBytes)
+	}
+	if stats := GetDynamoDbStats("spill").Snapshot(); stats.Evictions != 1 {
+		t.Errorf("Expected eviction to be counted. Got %+v", stats)
+	}
+
+	// Peeking does not promote
+	if data, ok := (&dynamoDbSource{}).Peek("spill@@b"); !ok || data.Data != "b"+strings.Repeat("2", 39) {
+		t.Errorf("Expected b on disk. Got %+v", data)
+	}
+	if _, ok := dynamoDbCache["spill@@b"]; ok {
+		t.Error("Expected peeked entry to stay on disk")
+	}
+	if keys := (&dynamoDbSource{}).Keys("spill@@"); len(keys) != 3 {
+		t.Errorf("Expected keys in memory and on disk. Got %v", keys)
+	}
+
+	// A hit on disk is promoted back to memory, evicting a in turn
+	dbCache, ok := getDynamoDbCache("spill@@b")
+	if !ok || dbCache.Data.Data != "b"+strings.Repeat("2", 39) || dbCache.Config.HashKeyValue != "b" {
+		t.Fatalf("Expected b from disk. Got %+v", dbCache)
+	}
+	if _, ok := dynamoDbCache["spill@@b"]; !ok {
+		t.Error("Expected b to be promoted to memory")
+	}
+	if _, ok := dynamoDbCache["spill@@a"]; ok {
+		t.Error("Expected a to be evicted by the promotion")
+	}
+	if result, _ := FetchDynamoDbCache("spill@@a"); result.Data != "a"+strings.Repeat("1", 39) || result.Tier != TierDisk {
+		t.Errorf("Expected a to be served from disk. Got %+v", result)
+	}
+
+	// Items in memory and on disk are counted once
+	if counts := dynamoDbTableCounts(); counts["spill"] != 3 {
+		t.Errorf("Expected 3 items of the table. Got %v", counts)
+	}
+
+	deleteDynamoDbCache("spill@@c")
+	if _, ok := getDiskEntry("spill@@c"); ok {
+		t.Error("Expected deleted entry to be removed from disk")
+	}
+	if _, ok := getDynamoDbCache("spill@@c"); ok {
+		t.Error("Expected deleted entry to be removed from memory")
+	}
+}
+
+func TestDiskEntryKeyOnly(t *testing.T) {
+	t.Setenv(DiskCachePath, filepath.Join(t.TempDir(), "dynamodb.db"))
+	diskCache, diskCacheOnce = nil, sync.Once{}
+	previous := initializedConfig
+	defer func() {
+		CloseDiskCache()
+		diskCache, diskCacheOnce = nil, sync.Once{}
+		initializedConfig = previous
+	}()
+
+	config := DynamoDbConfiguration{Table: "orders", HashKey: "pk", HashKeyType: "S", AwsConfiguration: AwsConfiguration{ExternalId: "secret"}}
+	initializedConfig = map[string]DynamoDbConfiguration{"orders": config}
+	config.HashKeyValue = "a"
+	entry := &dynamoDbCacheEntry{name: "orders@@a", cache: DynamoDbCache{Data: CacheData{Data: `{"pk":"a"}`}, Config: config}}
+	if !putDiskEntries([]*dynamoDbCacheEntry{entry}) {
+		t.Fatal("Expected the entry to be written")
+	}
+
+	var value []byte
+	_ = getDiskCache().View(func(tx *bolt.Tx) error {
+		value = append(value, tx.Bucket(dynamoDbBucket).Get([]byte("orders@@a"))...)
+		return nil
+	})
+	if strings.Contains(string(value), "secret") || strings.Contains(string(value), "HashKeyType") {
+		t.Errorf("Expected only the key of the item on disk. Got %s", value)
+	}
+
+	// The rest of the configuration is taken from the table
+	dbCache, ok := getDiskEntry("orders@@a")
+	if !ok || dbCache.Config.HashKeyValue != "a" || dbCache.Config.HashKey != "pk" || dbCache.Config.ExternalId != "secret" {
+		t.Errorf("Expected the configuration of the table. Got %+v", dbCache.Config)
+	}
+}
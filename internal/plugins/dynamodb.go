@@ -1,27 +1,51 @@
 package plugins
 
 import (
+	"container/list"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"golang.org/x/sync/singleflight"
 )
 
+// Cache type of Dynamodb, also used to name its origins
+const Dynamodb = "dynamodb"
+
+// Items are served as JSON objects
+const dynamoDbContentType = "application/json"
+
 // Struct to store Dynamodb cache confirmation
 type DynamoDbConfiguration struct {
-	Table        string `yaml:"table"`
-	HashKey      string `yaml:"hashKey"`
-	HashKeyType  string `yaml:"hashKeyType"`
-	HashKeyValue string `yaml:"hashKeyValue"`
-	SortKey      string `yaml:"sortKey"`
-	SortKeyType  string `yaml:"sortKeyType"`
-	SortKeyValue string `yaml:"sortKeyValue"`
-	Fields       string `yaml:"fields"`
+	Table        string          `yaml:"table"`
+	HashKey      string          `yaml:"hashKey"`
+	HashKeyType  string          `yaml:"hashKeyType"`
+	HashKeyValue string          `yaml:"hashKeyValue"`
+	SortKey      string          `yaml:"sortKey"`
+	SortKeyType  string          `yaml:"sortKeyType"`
+	SortKeyValue string          `yaml:"sortKeyValue"`
+	Fields       string          `yaml:"fields"`
+	TtlAttribute string          `yaml:"ttlAttribute"`
+	Indexes      []DynamoDbIndex `yaml:"-"`
+
+	// Optional snapshot in S3 loaded instead of scanning the table
+	Snapshot *DynamoDbSnapshot `yaml:"snapshot"`
+
+	// Region, endpoint and credentials used for this table
+	AwsConfiguration `yaml:",inline"`
 }
 
 // Struct for caching the information
@@ -30,22 +54,335 @@ type DynamoDbCache struct {
 	Config DynamoDbConfiguration
 }
 
+// Entry of the in-memory cache, kept in least recently used order
+type dynamoDbCacheEntry struct {
+	name  string
+	cache DynamoDbCache
+	size  int
+	// Lookups served from the entry since it was loaded into memory
+	hits uint64
+}
+
 var (
-	dynamoDbCache  = make(map[string]DynamoDbCache)
-	dynamoDbClient = GetDynamoDbClient()
+	dynamoDbCache = make(map[string]*list.Element)
+	// Most recently used entries first
+	dynamoDbLru        = list.New()
+	dynamoDbCacheBytes int
+	dynamoDbStats      = make(map[string]*CacheStats)
+	dynamoDbCacheMu    sync.Mutex
+	// Entries evicted from memory until they are written to the disk tier
+	dynamoDbSpilling = make(map[string]*dynamoDbCacheEntry)
+	// Orders writes and removals of the disk tier, taken without holding dynamoDbCacheMu
+	dynamoDbDiskMu sync.Mutex
+	// Clients by table
+	dynamoDbClients = newClientCache[string](func(sess *session.Session, _ AwsConfiguration) dynamodbiface.DynamoDBAPI {
+		return dynamodb.New(sess)
+	})
+	// Reads items missing or expired in the cache, one call per item at a time
+	dynamoDbItemGroup singleflight.Group
+	// Warmup of the tables, reported by /ready
+	dynamoDbWarmup = newWarmupTracker()
 )
 var initializedConfig map[string]DynamoDbConfiguration
 
+// Source serving items of the configured Dynamodb tables
+type dynamoDbSource struct{}
+
+func init() {
+	RegisterSource(Dynamodb, &dynamoDbSource{})
+}
+
+// Initialize the tables listed in the dynamodb section of cache.yaml
+func (s *dynamoDbSource) Init(unmarshal func(interface{}) error) error {
+	var configs []DynamoDbConfiguration
+	if err := unmarshal(&configs); err != nil {
+		return err
+	}
+	if err := InitDynamodb(configs, false); err != nil {
+		return err
+	}
+	loadBundledSnapshot()
+	for table := range bundledTables {
+		dynamoDbWarmup.finish(table, nil)
+	}
+
+	// Periodically write snapshots of the tables configured to do so
+	for _, config := range initializedConfig {
+		if config.Snapshot != nil && config.Snapshot.exportInterval > 0 {
+			go exportSnapshotPeriodically(config)
+		}
+	}
+	return nil
+}
+
+// Load all items of every table, from its snapshot if one is configured. Lookups may wait for
+// the tables marked as loading by InitDynamodb
+func (s *dynamoDbSource) Preload() error {
+	var failed []string
+	for table, config := range initializedConfig {
+		if bundledTables[table] {
+			continue
+		}
+		if config.Snapshot != nil {
+			err := LoadSnapshot(config)
+			if err == nil {
+				dynamoDbWarmup.finish(table, nil)
+				continue
+			}
+			println(PrintPrefix, fmt.Sprintf("Could not load snapshot of table %s, scanning it instead: %s", table, err))
+		}
+		if !LoadData(config) {
+			failed = append(failed, table)
+			dynamoDbWarmup.finish(table, fmt.Errorf("could not scan table %s", table))
+			continue
+		}
+		dynamoDbWarmup.finish(table, nil)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not load tables %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (s *dynamoDbSource) Fetch(request CacheRequest) (CacheResult, error) {
+	return fetchDynamoDbCache(request.Name, request.NoCache)
+}
+
+// Read the cached items of a partition, the name is "<table>@@<hashKeyValue>". Only items which
+// are already cached are returned, expired ones are refreshed like lookups of single items
+func (s *dynamoDbSource) Query(request CacheRequest) ([]CacheResult, error) {
+	parts := strings.Split(request.Name, "@@")
+	config, ok := initializedConfig[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("%w: table %s is not configured", ErrNotFound, parts[0])
+	}
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("%w: query '%s' does not match <table>@@<hashKeyValue>", ErrInvalidRequest, request.Name)
+	}
+
+	// A table without sort key has a single item per partition
+	if config.SortKey == "" {
+		result, err := fetchDynamoDbCache(request.Name, request.NoCache)
+		if err != nil {
+			return nil, err
+		}
+		return []CacheResult{result}, nil
+	}
+
+	names := s.Keys(request.Name + "@@")
+	results := make([]CacheResult, 0, len(names))
+	for _, name := range names {
+		result, err := fetchDynamoDbCache(name, request.NoCache)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (s *dynamoDbSource) Invalidate(name string) {
+	deleteDynamoDbCache(name)
+	deleteSharedCache(name)
+}
+
+// Return the names of the cached items in memory and on disk
+func (s *dynamoDbSource) Keys(prefix string) []string {
+	entries := dynamoDbEntries(prefix)
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Return a cached item without promoting it from disk to memory
+func (s *dynamoDbSource) Peek(name string) (CacheData, bool) {
+	dynamoDbCacheMu.Lock()
+	if element, ok := dynamoDbCache[name]; ok {
+		data := element.Value.(*dynamoDbCacheEntry).cache.Data
+		dynamoDbCacheMu.Unlock()
+		return data, true
+	}
+	if entry, ok := dynamoDbSpilling[name]; ok {
+		dynamoDbCacheMu.Unlock()
+		return entry.cache.Data, true
+	}
+	dynamoDbCacheMu.Unlock()
+
+	dbCache, ok := getDiskEntry(name)
+	return dbCache.Data, ok
+}
+
+// Return the metadata of a cached item, from memory or from disk without promoting it
+func (s *dynamoDbSource) Entry(name string) (EntryInfo, bool) {
+	dynamoDbCacheMu.Lock()
+	if element, ok := dynamoDbCache[name]; ok {
+		entry := element.Value.(*dynamoDbCacheEntry)
+		info := entryInfo(name, entry.cache, TierMemory)
+		info.Hits = entry.hits
+		dynamoDbCacheMu.Unlock()
+		return info, true
+	}
+	if entry, ok := dynamoDbSpilling[name]; ok {
+		dynamoDbCacheMu.Unlock()
+		return entryInfo(name, entry.cache, TierMemory), true
+	}
+	dynamoDbCacheMu.Unlock()
+
+	dbCache, ok := getDiskEntry(name)
+	if !ok {
+		return EntryInfo{}, false
+	}
+	return entryInfo(name, dbCache, TierDisk), true
+}
+
+// Return the number and size of the cached items of every table, in memory and on disk
+func (s *dynamoDbSource) Usage() map[string]CacheUsage {
+	usage := make(map[string]CacheUsage)
+	for name, dbCache := range dynamoDbEntries("") {
+		table := dbCache.Config.Table
+		if table == "" {
+			table, _, _ = strings.Cut(name, "@@")
+		}
+		tableUsage := usage[table]
+		tableUsage.Entries++
+		tableUsage.Bytes += len(name) + len(dbCache.Data.Data)
+		usage[table] = tableUsage
+	}
+	return usage
+}
+
+// Build the metadata of a cached item
+func entryInfo(name string, dbCache DynamoDbCache, tier string) EntryInfo {
+	return EntryInfo{
+		Size:        len(name) + len(dbCache.Data.Data),
+		Tier:        tier,
+		FetchedAt:   dbCache.Data.FetchedAt,
+		CacheExpiry: dbCache.Data.CacheExpiry,
+		Config:      dbCache.Config.describe(),
+	}
+}
+
+// Return the settings of a configuration which are set, keyed like cache.yaml. The external id
+// of the role is left out
+func (c DynamoDbConfiguration) describe() map[string]string {
+	settings := map[string]string{
+		"table":        c.Table,
+		"hashKey":      c.HashKey,
+		"hashKeyType":  c.HashKeyType,
+		"hashKeyValue": c.HashKeyValue,
+		"sortKey":      c.SortKey,
+		"sortKeyType":  c.SortKeyType,
+		"sortKeyValue": c.SortKeyValue,
+		"fields":       c.Fields,
+		"ttlAttribute": c.TtlAttribute,
+		"region":       c.Region,
+		"endpoint":     c.Endpoint,
+		"roleArn":      c.RoleArn,
+	}
+	for key, value := range settings {
+		if value == "" {
+			delete(settings, key)
+		}
+	}
+	return settings
+}
+
+// Report the warmup of every configured table with its number of cached items
+func (s *dynamoDbSource) Warmup() map[string]WarmStatus {
+	counts := dynamoDbTableCounts()
+	warmup := make(map[string]WarmStatus, len(initializedConfig))
+	for table := range initializedConfig {
+		status := dynamoDbWarmup.status(table)
+		status.Items = counts[table]
+		warmup[table] = status
+	}
+	return warmup
+}
+
+// The tables not loaded from the bundled snapshot are loaded on their first lookup
+func (s *dynamoDbSource) SkipWarmup() {
+	dynamoDbWarmup.skip()
+}
+
+// Count the cached items of every table in memory and on disk in a single pass over their names
+func dynamoDbTableCounts() map[string]int {
+	names := make(map[string]bool)
+	forEachDiskName(func(name string) {
+		names[name] = true
+	})
+	dynamoDbCacheMu.Lock()
+	for name := range dynamoDbCache {
+		names[name] = true
+	}
+	for name := range dynamoDbSpilling {
+		names[name] = true
+	}
+	dynamoDbCacheMu.Unlock()
+
+	counts := make(map[string]int)
+	for name := range names {
+		table, _, _ := strings.Cut(name, "@@")
+		counts[table]++
+	}
+	return counts
+}
+
+func (s *dynamoDbSource) Stats() map[string]CacheStats {
+	dynamoDbCacheMu.Lock()
+	defer dynamoDbCacheMu.Unlock()
+
+	stats := make(map[string]CacheStats, len(dynamoDbStats))
+	for table, tableStats := range dynamoDbStats {
+		stats[table] = tableStats.Snapshot()
+	}
+	return stats
+}
+
 // Initialize map and cache data (only if requested)
-func InitDynamodb(configs []DynamoDbConfiguration, initializeCache bool) {
+func InitDynamodb(configs []DynamoDbConfiguration, initializeCache bool) error {
+	// Every table is loading until it is preloaded or lazy, also while its schema is described
+	tables := make([]string, 0, len(configs))
+	for _, config := range configs {
+		tables = append(tables, config.Table)
+	}
+	dynamoDbWarmup.reset(tables)
+
 	initializedConfig = make(map[string]DynamoDbConfiguration, len(configs))
 	for _, config := range configs {
+		if err := initSnapshot(config); err != nil {
+			return fmt.Errorf("snapshot of table %s: %w", config.Table, err)
+		}
+
+		// Discover key schema, attribute types and indexes of the table
+		err := DescribeKeySchema(&config)
+		if errors.Is(err, ErrSchemaMismatch) {
+			return err
+		}
+		if err != nil {
+			// Only this table is affected, lookups will report the error
+			println(PrintPrefix, fmt.Sprintf("Caching disabled for table %s: %s", config.Table, err))
+			initializedConfig[config.Table] = config
+			continue
+		}
+
+		// Discover the table's native TTL attribute if not configured explicitly
+		if config.TtlAttribute == "" {
+			config.TtlAttribute = DescribeTtlAttribute(config)
+		}
+
 		initializedConfig[config.Table] = config
 		if initializeCache {
 			// Load data from Dynamodb
 			LoadData(config)
 		}
 	}
+	return nil
 }
 
 func buildProjectionExpression(fieldExpr string) (*string, map[string]*string) {
@@ -69,67 +406,86 @@ func buildProjectionExpression(fieldExpr string) (*string, map[string]*string) {
 	return nil, nil
 }
 
+// Projection fields of a table, including the TTL attribute so item expiry can be evaluated
+func projectionFields(config DynamoDbConfiguration) string {
+	if config.Fields == "" || config.TtlAttribute == "" {
+		return config.Fields
+	}
+	for _, field := range strings.Split(config.Fields, ",") {
+		if field == config.TtlAttribute {
+			return config.Fields
+		}
+	}
+	return config.Fields + "," + config.TtlAttribute
+}
+
+// Remove the TTL attribute from an item once its expiry is known, unless fields asked for it
+func clientItem(config DynamoDbConfiguration, item map[string]interface{}) map[string]interface{} {
+	if config.Fields == "" || config.TtlAttribute == "" {
+		return item
+	}
+	for _, field := range strings.Split(config.Fields, ",") {
+		if field == config.TtlAttribute {
+			return item
+		}
+	}
+	delete(item, config.TtlAttribute)
+	return item
+}
+
 // Load data from Dynamodb
 func LoadData(config DynamoDbConfiguration) bool {
 	if config.HashKey != "" {
 
 		// Set up the input parameters for the Scan operation
-		projection, attributeNames := buildProjectionExpression(config.Fields)
+		projection, attributeNames := buildProjectionExpression(projectionFields(config))
 		params := &dynamodb.ScanInput{
 			TableName:                aws.String(config.Table),
 			ProjectionExpression:     projection,
 			ExpressionAttributeNames: attributeNames,
 		}
 
-		// Execute the Scan operation to read every item in the table.
-		items := make([]map[string]interface{}, 0)
-		err := dynamoDbClient.ScanPages(params, func(page *dynamodb.ScanOutput, lastPage bool) bool {
-			// Unmarshal the page of items into a slice of structs.
-			pageItems := make([]map[string]interface{}, len(page.Items))
-			err := dynamodbattribute.UnmarshalListOfMaps(page.Items, &pageItems)
-			if err != nil {
-				fmt.Println("Error unmarshaling page items:", err)
-				return false
-			}
-
-			// Add the page of items to the overall slice.
-			items = append(items, pageItems...)
-
-			// If there are more pages, continue scanning.
-			return !lastPage
-		})
+		dynamoDbClient, err := GetDynamoDbClient(config)
 		if err != nil {
-			fmt.Println("Error scanning table:", err)
+			println(PrintPrefix, fmt.Sprintf("Error creating client for table %s: %s", config.Table, err))
 			return false
 		}
 
-		// Add it to the cache
-		for _, item := range items {
-			key := GenerateCacheKey(config, item)
-			jsonData, err := json.Marshal(item)
+		// Execute the Scan operation to read every item in the table. Items are cached page by page
+		// so tables larger than memory can spill over to the disk tier, every page is bounded by the
+		// origin timeout
+		for {
+			var page *dynamodb.ScanOutput
+			err = GetCircuitBreaker(Dynamodb + ":" + config.Table).Call(func() error {
+				ctx, cancel := OriginContext()
+				defer cancel()
+				var err error
+				page, err = dynamoDbClient.ScanWithContext(ctx, params)
+				return err
+			})
 			if err != nil {
-				print(err.Error())
+				fmt.Println("Error scanning table:", err)
+				return false
 			}
 
-			// create a new config object with store hash key value and sort key value to retrieve item when cache exipre
-			new_config := new(DynamoDbConfiguration)
-
-			// Copy the values from config to new_config
-			*new_config = config
+			// Unmarshal the page of items into a slice of structs.
+			pageItems := make([]map[string]interface{}, len(page.Items))
+			err = dynamodbattribute.UnmarshalListOfMaps(page.Items, &pageItems)
+			if err != nil {
+				fmt.Println("Error unmarshaling page items:", err)
+				return false
+			}
 
-			// Update HashKeyValue and SortKeyValue
-			new_config.HashKeyValue, _ = GetHashKeyValue(item, config)
-			if config.SortKey != "" {
-				new_config.SortKeyValue, _ = GetSortKeyValue(item, config)
+			// Add the page of items to the cache
+			for _, item := range pageItems {
+				cacheItem(config, item, time.Now())
 			}
 
-			dynamoDbCache[key] = DynamoDbCache{
-				Data: CacheData{
-					Data:        string(jsonData),
-					CacheExpiry: GetCacheExpiry(),
-				},
-				Config: *new_config,
+			// If there are more pages, continue scanning.
+			if len(page.LastEvaluatedKey) == 0 {
+				break
 			}
+			params.ExclusiveStartKey = page.LastEvaluatedKey
 		}
 
 		return true
@@ -139,25 +495,79 @@ func LoadData(config DynamoDbConfiguration) bool {
 	}
 }
 
+// Add an item read by a scan or from a snapshot to the cache. Items read earlier expire one TTL
+// after they were read and are refreshed on the next lookup
+func cacheItem(config DynamoDbConfiguration, item map[string]interface{}, fetchedAt time.Time) {
+	// Skip items which already expired but were not yet deleted by Dynamodb
+	expiry := GetItemExpiry(config, item)
+	if IsExpired(expiry) {
+		return
+	}
+
+	key := GenerateCacheKey(config, item)
+	cacheData := newItemCacheData(config, item, "")
+	jsonData, err := json.Marshal(clientItem(config, item))
+	if err != nil {
+		print(err.Error())
+	}
+	cacheData.Data = string(jsonData)
+
+	// create a new config object with store hash key value and sort key value to retrieve item when cache exipre
+	new_config := new(DynamoDbConfiguration)
+
+	// Copy the values from config to new_config
+	*new_config = config
+
+	// Update HashKeyValue and SortKeyValue
+	new_config.HashKeyValue, _ = GetHashKeyValue(item, config)
+	if config.SortKey != "" {
+		new_config.SortKeyValue, _ = GetSortKeyValue(item, config)
+	}
+
+	if age := time.Since(fetchedAt); age > 0 {
+		cacheData.FetchedAt = fetchedAt
+		if expiry := GetCacheExpiry().Add(-age); expiry.Before(cacheData.CacheExpiry) {
+			cacheData.CacheExpiry = expiry
+		}
+	}
+
+	setDynamoDbCache(key, DynamoDbCache{
+		Data:   cacheData,
+		Config: *new_config,
+	})
+}
+
 // Get hash key value from an item in the table based on given configuration
 func GetHashKeyValue(data map[string]interface{}, config DynamoDbConfiguration) (string, error) {
-	rawHasKeyValue := data[config.HashKey]
-	hasKeyValue, ok := rawHasKeyValue.(string)
+	hasKeyValue, ok := keyValueString(data[config.HashKey])
 	if ok {
 		return hasKeyValue, nil
 	} else {
-		return "", fmt.Errorf("the value of hash key %s not a string. Expected a string value", config.HashKey)
+		return "", fmt.Errorf("the value of hash key %s is not a string, number or binary value", config.HashKey)
 	}
 }
 
 // Get sort key value from an item in the table based on given configuration
 func GetSortKeyValue(data map[string]interface{}, config DynamoDbConfiguration) (string, error) {
-	rawSortKeyValue := data[config.SortKey]
-	sortKeyValue, ok := rawSortKeyValue.(string)
+	sortKeyValue, ok := keyValueString(data[config.SortKey])
 	if ok {
 		return sortKeyValue, nil
 	} else {
-		return "", fmt.Errorf("the value of sort key %s not a string. Expected a string value", config.SortKey)
+		return "", fmt.Errorf("the value of sort key %s is not a string, number or binary value", config.SortKey)
+	}
+}
+
+// Convert an unmarshalled key attribute to the string used in cache keys, binary values are base64 encoded
+func keyValueString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v), true
+	default:
+		return "", false
 	}
 }
 
@@ -183,57 +593,135 @@ func GenerateCacheKey(config DynamoDbConfiguration, data map[string]interface{})
 
 // Read specific data from Dynamodb
 func GetData(config DynamoDbConfiguration) string {
+	data, err := getItem(config)
+	if err != nil {
+		println(PrintPrefix, PrettyPrint(err.Error()))
+		return ""
+	}
+	return data.Data
+}
+
+// Read specific data from Dynamodb and add it to the cache, returns empty data if the item does not exist
+func getItem(config DynamoDbConfiguration) (CacheData, error) {
 	println(PrintPrefix, "Fetch data to cache for '"+config.HashKeyValue+"'")
 	if config.HashKey != "" {
 		// Create attributeValue map based on hash and sort key
 		var attributeMap = map[string]*dynamodb.AttributeValue{}
 		UpdateAttributeMap(attributeMap, config)
-		projection, attributeNames := buildProjectionExpression(config.Fields)
+		projection, attributeNames := buildProjectionExpression(projectionFields(config))
 
-		result, err := dynamoDbClient.GetItem(&dynamodb.GetItemInput{
-			TableName:                aws.String(config.Table),
-			Key:                      attributeMap,
-			ProjectionExpression:     projection,
-			ExpressionAttributeNames: attributeNames,
-		})
+		dynamoDbClient, err := GetDynamoDbClient(config)
+		if err != nil {
+			return CacheData{}, fmt.Errorf("could not create client for table %s: %w", config.Table, err)
+		}
 
+		// Bound the call by the origin timeout and fail fast while the table is unhealthy
+		var result *dynamodb.GetItemOutput
+		err = GetCircuitBreaker(Dynamodb + ":" + config.Table).Call(func() error {
+			ctx, cancel := OriginContext()
+			defer cancel()
+
+			var err error
+			result, err = dynamoDbClient.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+				TableName:                aws.String(config.Table),
+				Key:                      attributeMap,
+				ProjectionExpression:     projection,
+				ExpressionAttributeNames: attributeNames,
+			})
+			return err
+		})
 		if err != nil {
-			println(PrintPrefix, PrettyPrint(err.Error()))
-			return ""
+			return CacheData{}, err
 		}
 
 		if result.Item == nil {
 			println(PrintPrefix, "Could not find '"+config.HashKeyValue+"'")
-			return ""
+			return CacheData{}, nil
 		}
 
 		// Convert data from Map to JSON string
 		var data = make(map[string]interface{})
 		_ = dynamodbattribute.UnmarshalMap(result.Item, &data)
 
+		// Never serve an item whose TTL has passed, even if Dynamodb has not deleted it yet
+		expiry := GetItemExpiry(config, data)
+		if IsExpired(expiry) {
+			println(PrintPrefix, "Item '"+config.HashKeyValue+"' has expired")
+			deleteDynamoDbCache(GenerateCacheKey(config, data))
+			return CacheData{}, nil
+		}
+
 		// Convert map to JSON string
-		jsonData, err := json.Marshal(data)
+		key := GenerateCacheKey(config, data)
+		cacheData := newItemCacheData(config, data, "")
+		jsonData, err := json.Marshal(clientItem(config, data))
 		if err != nil {
 			println(err.Error())
 		}
+		cacheData.Data = string(jsonData)
 
 		// Add it to the cache
-		var value = string(jsonData)
-		dynamoDbCache[GenerateCacheKey(config, data)] = DynamoDbCache{
-			Data: CacheData{
-				Data:        value,
-				CacheExpiry: GetCacheExpiry(),
-			},
+		setDynamoDbCache(key, DynamoDbCache{
+			Data:   cacheData,
 			Config: config,
-		}
+		})
 
-		return value
+		return cacheData, nil
 	} else {
-		println(PrintPrefix, "Hash key not available so caching will not be enabled for", config.HashKey)
-		return ""
+		return CacheData{}, fmt.Errorf("%w: key schema of table %s is unknown", ErrOriginUnavailable, config.Table)
 	}
 }
 
+// Return the cache expiry of an item which is the earlier of its TTL attribute and the cache TTL
+func GetItemExpiry(config DynamoDbConfiguration, data map[string]interface{}) time.Time {
+	expiry := GetCacheExpiry()
+	itemExpiry, ok := GetItemTtl(config, data)
+	if ok && itemExpiry.Before(expiry) {
+		return itemExpiry
+	}
+	return expiry
+}
+
+// Return the expiry given by the TTL attribute of an item, if it has one
+func GetItemTtl(config DynamoDbConfiguration, data map[string]interface{}) (time.Time, bool) {
+	if config.TtlAttribute == "" {
+		return time.Time{}, false
+	}
+
+	// Dynamodb TTL attribute is a number holding an epoch timestamp in seconds
+	var epoch float64
+	switch value := data[config.TtlAttribute].(type) {
+	case float64:
+		epoch = value
+	case string:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		epoch = parsed
+	default:
+		return time.Time{}, false
+	}
+	if epoch <= 0 {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(epoch), 0), true
+}
+
+// Build the cache data of an item
+func newItemCacheData(config DynamoDbConfiguration, data map[string]interface{}, value string) CacheData {
+	cacheData := CacheData{
+		Data:        value,
+		CacheExpiry: GetItemExpiry(config, data),
+		FetchedAt:   time.Now(),
+	}
+	if itemExpiry, ok := GetItemTtl(config, data); ok {
+		cacheData.HardExpiry = itemExpiry
+	}
+	return cacheData
+}
+
 // Create attributeValue based on key type and presence of sortKey definition
 func UpdateAttributeMap(attributeMap map[string]*dynamodb.AttributeValue, dynamodbConfig DynamoDbConfiguration) {
 	GetAttributeValue(attributeMap, dynamodbConfig.HashKey, dynamodbConfig.HashKeyValue, dynamodbConfig.HashKeyType)
@@ -242,42 +730,281 @@ func UpdateAttributeMap(attributeMap map[string]*dynamodb.AttributeValue, dynamo
 	}
 }
 
-// Supports attributeValue with data types "S" and "N"
+// Supports attributeValue with data types "S", "N" and "B" (base64 encoded)
 func GetAttributeValue(attributeMap map[string]*dynamodb.AttributeValue, key string, value string, keyType string) {
 	switch keyType {
-	case "S":
+	case dynamodb.ScalarAttributeTypeS:
 		attributeMap[key] = &dynamodb.AttributeValue{S: aws.String(value)}
-	case "N":
+	case dynamodb.ScalarAttributeTypeN:
 		attributeMap[key] = &dynamodb.AttributeValue{N: aws.String(value)}
+	case dynamodb.ScalarAttributeTypeB:
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			println(PrintPrefix, fmt.Sprintf("Value of key %s is not base64 encoded: %s", key, err))
+			return
+		}
+		attributeMap[key] = &dynamodb.AttributeValue{B: decoded}
 	}
 }
 
-// Get Dynamodb to read data
-func GetDynamoDbClient() *dynamodb.DynamoDB {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
-
-	// Create Dynamodb client
-	return dynamodb.New(sess)
+// Get the Dynamodb client of a table, created on first use with the table's region, endpoint and role
+func GetDynamoDbClient(config DynamoDbConfiguration) (dynamodbiface.DynamoDBAPI, error) {
+	return dynamoDbClients.get(config.Table, config.AwsConfiguration)
 }
 
 // Fetch data from cache
-func FetchDynamoDbCache(name string) string {
-	var dbCache = dynamoDbCache[name]
-
-	// If expired or not available in cache then read it from Dynamodb, else return from cache
-	if dbCache.Data.Data == "" || IsExpired(dbCache.Data.CacheExpiry) {
-		config := dynamoDbCache[name].Config
-		if dbCache.Config.HashKeyValue == "" {
-			cacheKeyInfo := strings.Split(name, "@@")
-			tableName := cacheKeyInfo[0]
-			config = initializedConfig[tableName]
-			config.HashKeyValue = cacheKeyInfo[1]
-			config.SortKeyValue = cacheKeyInfo[2]
-		}
-		return GetData(config)
+func FetchDynamoDbCache(name string) (CacheResult, error) {
+	return fetchDynamoDbCache(name, false)
+}
+
+// Fetch data from cache, a bypass reads the item from Dynamodb even if the cached copy has not expired
+func fetchDynamoDbCache(name string, bypass bool) (CacheResult, error) {
+	dbCache, tier := lookupDynamoDbCache(name)
+	if dbCache.Data.Data == "" && !bypass {
+		// The item may still be loaded by the warmup of its table
+		table, _, _ := strings.Cut(name, "@@")
+		if dynamoDbWarmup.wait(table) {
+			dbCache, tier = lookupDynamoDbCache(name)
+		}
+	}
+	if dbCache.Data.Data != "" && !IsExpired(dbCache.Data.CacheExpiry) && !bypass {
+		recordDynamoDbHit(name, dbCache.Config.Table)
+		return dynamoDbResult(name, dbCache.Data, CacheHit, tier), nil
+	}
+
+	// If expired or not available in cache then read it from Dynamodb
+	config := dbCache.Config
+	if config.HashKeyValue == "" {
+		var err error
+		config, err = configForCacheKey(name)
+		if err != nil {
+			return CacheResult{}, err
+		}
+	}
+
+	// Another execution environment may have loaded the item into the shared cache
+	if !bypass {
+		if data, ok := getSharedCache(name); ok {
+			setDynamoDbCache(name, DynamoDbCache{Data: data, Config: config})
+			recordDynamoDbHit(name, config.Table)
+			return dynamoDbResult(name, data, CacheHit, TierShared), nil
+		}
+		atomic.AddUint64(&GetDynamoDbStats(config.Table).Misses, 1)
+	}
+
+	// Concurrent lookups of the same item share a single call to Dynamodb
+	value, err, _ := dynamoDbItemGroup.Do(name, func() (interface{}, error) {
+		data, err := getItem(config)
+		if err == nil && data.Data != "" {
+			setSharedCache(name, data)
+		}
+		return data, err
+	})
+	data, _ := value.(CacheData)
+	if err != nil {
+		println(PrintPrefix, PrettyPrint(err.Error()))
+		stats := GetDynamoDbStats(config.Table)
+		atomic.AddUint64(&stats.OriginErrors, 1)
+		dynamoDbWarmup.recordError(config.Table, err)
+
+		// Serve the expired copy within the maximum staleness while Dynamodb is unavailable
+		if isStaleServable(err) && CanServeStale(dbCache.Data) {
+			served := atomic.AddUint64(&stats.StaleServed, 1)
+			println(PrintPrefix, fmt.Sprintf("Serving stale data for '%s' while Dynamodb is unavailable (%d stale responses for table %s)",
+				name, served, config.Table))
+			return dynamoDbResult(name, dbCache.Data, CacheStale, tier), nil
+		}
+		return CacheResult{}, originError(err)
+	}
+	if data.Data == "" {
+		return CacheResult{}, fmt.Errorf("%w: item '%s'", ErrNotFound, name)
+	}
+
+	status := CacheMiss
+	if bypass {
+		status = CacheBypass
+	}
+	return dynamoDbResult(name, data, status, TierOrigin), nil
+}
+
+// Build the result of a lookup of an item, items are always JSON
+func dynamoDbResult(name string, data CacheData, status CacheStatus, tier string) CacheResult {
+	result := data.Result(name, status, tier)
+	result.ContentType = dynamoDbContentType
+	return result
+}
+
+// Build the configuration of a lookup from its cache key "<table>@@<hashKeyValue>@@<sortKeyValue>",
+// the sort key value is only given for tables with a sort key
+func configForCacheKey(name string) (DynamoDbConfiguration, error) {
+	parts := strings.Split(name, "@@")
+	config, ok := initializedConfig[parts[0]]
+	if !ok {
+		return config, fmt.Errorf("%w: table %s is not configured", ErrNotFound, parts[0])
+	}
+
+	expected := 2
+	format := "<table>@@<hashKeyValue>"
+	if config.SortKey != "" {
+		expected = 3
+		format += "@@<sortKeyValue>"
+	}
+	for _, part := range parts {
+		if part == "" {
+			expected = -1
+		}
+	}
+	if len(parts) != expected {
+		return config, fmt.Errorf("%w: key '%s' does not match %s", ErrInvalidRequest, name, format)
+	}
+
+	config.HashKeyValue = parts[1]
+	if config.SortKey != "" {
+		config.SortKeyValue = parts[2]
+	}
+	return config, nil
+}
+
+// Get an entry from the cache. Entries evicted to the disk tier are promoted back to memory
+func getDynamoDbCache(name string) (DynamoDbCache, bool) {
+	dbCache, tier := lookupDynamoDbCache(name)
+	return dbCache, tier != ""
+}
+
+// Get an entry from the cache and the tier it was found in, empty if it is not cached
+func lookupDynamoDbCache(name string) (DynamoDbCache, string) {
+	dynamoDbCacheMu.Lock()
+	element, ok := dynamoDbCache[name]
+	if ok {
+		dynamoDbLru.MoveToFront(element)
+		dbCache := element.Value.(*dynamoDbCacheEntry).cache
+		dynamoDbCacheMu.Unlock()
+		return dbCache, TierMemory
+	}
+	if entry, ok := dynamoDbSpilling[name]; ok {
+		dynamoDbCacheMu.Unlock()
+		return entry.cache, TierMemory
+	}
+	dynamoDbCacheMu.Unlock()
+
+	dbCache, ok := getDiskEntry(name)
+	if !ok {
+		return dbCache, ""
+	}
+	storeDynamoDbCache(name, dbCache, false)
+	return dbCache, TierDisk
+}
+
+// Add an entry to the cache. When the cache exceeds CACHE_EXTENSION_MEMORY_MAX_BYTES the least
+// recently used entries are evicted to the disk tier, or dropped if there is none
+func setDynamoDbCache(name string, dbCache DynamoDbCache) {
+	storeDynamoDbCache(name, dbCache, true)
+}
+
+// Add an entry to the cache, an entry already in memory is only replaced if requested
+func storeDynamoDbCache(name string, dbCache DynamoDbCache, replace bool) {
+	maxBytes := getIntEnv(MemoryMaxBytes, 0)
+
+	dynamoDbCacheMu.Lock()
+	entry := &dynamoDbCacheEntry{name: name, cache: dbCache, size: len(name) + len(dbCache.Data.Data)}
+	if element, ok := dynamoDbCache[name]; ok {
+		if !replace {
+			dynamoDbCacheMu.Unlock()
+			return
+		}
+		previous := element.Value.(*dynamoDbCacheEntry)
+		dynamoDbCacheBytes -= previous.size
+		entry.hits = previous.hits
+		element.Value = entry
+		dynamoDbLru.MoveToFront(element)
 	} else {
-		return dynamoDbCache[name].Data.Data
+		dynamoDbCache[name] = dynamoDbLru.PushFront(entry)
+	}
+	dynamoDbCacheBytes += entry.size
+
+	var evicted []*dynamoDbCacheEntry
+	// The entry just added is kept even if it exceeds the limit on its own
+	for maxBytes > 0 && dynamoDbCacheBytes > maxBytes && dynamoDbLru.Len() > 1 {
+		oldest := dynamoDbLru.Remove(dynamoDbLru.Back()).(*dynamoDbCacheEntry)
+		delete(dynamoDbCache, oldest.name)
+		dynamoDbCacheBytes -= oldest.size
+		atomic.AddUint64(&dynamoDbTableStats(oldest.cache.Config.Table).Evictions, 1)
+		dynamoDbSpilling[oldest.name] = oldest
+		evicted = append(evicted, oldest)
+	}
+	dynamoDbCacheMu.Unlock()
+
+	spillDynamoDbCache(evicted)
+}
+
+// Write evicted entries to the disk tier without blocking lookups. Entries removed or evicted
+// again in the meantime are skipped, lookups are served from dynamoDbSpilling until written
+func spillDynamoDbCache(evicted []*dynamoDbCacheEntry) {
+	if len(evicted) == 0 {
+		return
+	}
+
+	dynamoDbDiskMu.Lock()
+	defer dynamoDbDiskMu.Unlock()
+
+	dynamoDbCacheMu.Lock()
+	current := evicted[:0]
+	for _, entry := range evicted {
+		if dynamoDbSpilling[entry.name] == entry {
+			current = append(current, entry)
+		}
+	}
+	dynamoDbCacheMu.Unlock()
+
+	putDiskEntries(current)
+
+	dynamoDbCacheMu.Lock()
+	for _, entry := range current {
+		if dynamoDbSpilling[entry.name] == entry {
+			delete(dynamoDbSpilling, entry.name)
+		}
+	}
+	dynamoDbCacheMu.Unlock()
+}
+
+// Remove an entry from the cache and the disk tier
+func deleteDynamoDbCache(name string) {
+	dynamoDbCacheMu.Lock()
+	if element, ok := dynamoDbCache[name]; ok {
+		dynamoDbCacheBytes -= dynamoDbLru.Remove(element).(*dynamoDbCacheEntry).size
+		delete(dynamoDbCache, name)
+	}
+	delete(dynamoDbSpilling, name)
+	dynamoDbCacheMu.Unlock()
+
+	dynamoDbDiskMu.Lock()
+	defer dynamoDbDiskMu.Unlock()
+	deleteDiskEntry(name)
+}
+
+// Count a lookup served from the cache for its entry and its table
+func recordDynamoDbHit(name string, table string) {
+	dynamoDbCacheMu.Lock()
+	defer dynamoDbCacheMu.Unlock()
+	if element, ok := dynamoDbCache[name]; ok {
+		element.Value.(*dynamoDbCacheEntry).hits++
+	}
+	atomic.AddUint64(&dynamoDbTableStats(table).Hits, 1)
+}
+
+// Get the counters of a table, created on first use
+func GetDynamoDbStats(table string) *CacheStats {
+	dynamoDbCacheMu.Lock()
+	defer dynamoDbCacheMu.Unlock()
+	return dynamoDbTableStats(table)
+}
+
+// Get the counters of a table, the caller holds dynamoDbCacheMu
+func dynamoDbTableStats(table string) *CacheStats {
+	stats, ok := dynamoDbStats[table]
+	if !ok {
+		stats = &CacheStats{}
+		dynamoDbStats[table] = stats
 	}
+	return stats
 }
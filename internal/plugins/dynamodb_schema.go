@@ -0,0 +1,136 @@
+package plugins
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Returned when the configured key schema contradicts the table definition
+var ErrSchemaMismatch = errors.New("key schema does not match the table definition")
+
+// Struct to store the key schema of a secondary index
+type DynamoDbIndex struct {
+	Name        string
+	HashKey     string
+	HashKeyType string
+	SortKey     string
+	SortKeyType string
+}
+
+// Fill the key schema, attribute types and indexes of a table using DescribeTable.
+// Explicitly configured keys are kept but must match the real table.
+func DescribeKeySchema(config *DynamoDbConfiguration) error {
+	dynamoDbClient, err := GetDynamoDbClient(*config)
+	if err != nil {
+		return fmt.Errorf("could not create client for table %s: %w", config.Table, err)
+	}
+
+	ctx, cancel := OriginContext()
+	defer cancel()
+	result, err := dynamoDbClient.DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(config.Table),
+	})
+	if err != nil {
+		// Without DescribeTable permission we can still work with a complete configuration
+		if config.HashKey != "" && config.HashKeyType != "" {
+			println(PrintPrefix, fmt.Sprintf("Could not describe table %s, using configured key schema: %s", config.Table, err))
+			return nil
+		}
+		return fmt.Errorf("could not describe table %s and no key schema is configured: %w", config.Table, err)
+	}
+
+	table := result.Table
+	attributeTypes := make(map[string]string, len(table.AttributeDefinitions))
+	for _, definition := range table.AttributeDefinitions {
+		attributeTypes[aws.StringValue(definition.AttributeName)] = aws.StringValue(definition.AttributeType)
+	}
+
+	hashKey, sortKey := keySchemaNames(table.KeySchema)
+	schema := map[string]*string{
+		"hashKey":     &config.HashKey,
+		"hashKeyType": &config.HashKeyType,
+		"sortKey":     &config.SortKey,
+		"sortKeyType": &config.SortKeyType,
+	}
+	actual := map[string]string{
+		"hashKey":     hashKey,
+		"hashKeyType": attributeTypes[hashKey],
+		"sortKey":     sortKey,
+		"sortKeyType": attributeTypes[sortKey],
+	}
+	for _, field := range []string{"hashKey", "hashKeyType", "sortKey", "sortKeyType"} {
+		configured := schema[field]
+		if *configured != "" && *configured != actual[field] {
+			return fmt.Errorf("%w: %s '%s' of table %s, expected '%s'",
+				ErrSchemaMismatch, field, *configured, config.Table, actual[field])
+		}
+		*configured = actual[field]
+	}
+
+	config.Indexes = config.Indexes[:0]
+	for _, index := range table.GlobalSecondaryIndexes {
+		config.Indexes = append(config.Indexes, newDynamoDbIndex(aws.StringValue(index.IndexName), index.KeySchema, attributeTypes))
+	}
+	for _, index := range table.LocalSecondaryIndexes {
+		config.Indexes = append(config.Indexes, newDynamoDbIndex(aws.StringValue(index.IndexName), index.KeySchema, attributeTypes))
+	}
+
+	println(PrintPrefix, fmt.Sprintf("Table %s has hash key '%s' (%s), sort key '%s' (%s) and %d indexes",
+		config.Table, config.HashKey, config.HashKeyType, config.SortKey, config.SortKeyType, len(config.Indexes)))
+	return nil
+}
+
+func newDynamoDbIndex(name string, keySchema []*dynamodb.KeySchemaElement, attributeTypes map[string]string) DynamoDbIndex {
+	hashKey, sortKey := keySchemaNames(keySchema)
+	return DynamoDbIndex{
+		Name:        name,
+		HashKey:     hashKey,
+		HashKeyType: attributeTypes[hashKey],
+		SortKey:     sortKey,
+		SortKeyType: attributeTypes[sortKey],
+	}
+}
+
+// Return the hash key and sort key names of a key schema
+func keySchemaNames(keySchema []*dynamodb.KeySchemaElement) (string, string) {
+	var hashKey, sortKey string
+	for _, element := range keySchema {
+		switch aws.StringValue(element.KeyType) {
+		case dynamodb.KeyTypeHash:
+			hashKey = aws.StringValue(element.AttributeName)
+		case dynamodb.KeyTypeRange:
+			sortKey = aws.StringValue(element.AttributeName)
+		}
+	}
+	return hashKey, sortKey
+}
+
+// Get the name of the TTL attribute of a table, empty if TTL is not enabled
+func DescribeTtlAttribute(config DynamoDbConfiguration) string {
+	table := config.Table
+	dynamoDbClient, err := GetDynamoDbClient(config)
+	if err != nil {
+		println(PrintPrefix, fmt.Sprintf("Could not describe TTL of table %s: %s", table, err))
+		return ""
+	}
+
+	ctx, cancel := OriginContext()
+	defer cancel()
+	result, err := dynamoDbClient.DescribeTimeToLiveWithContext(ctx, &dynamodb.DescribeTimeToLiveInput{
+		TableName: aws.String(table),
+	})
+	if err != nil {
+		println(PrintPrefix, fmt.Sprintf("Could not describe TTL of table %s: %s", table, err))
+		return ""
+	}
+
+	description := result.TimeToLiveDescription
+	if description == nil || aws.StringValue(description.TimeToLiveStatus) != dynamodb.TimeToLiveStatusEnabled {
+		return ""
+	}
+	println(PrintPrefix, fmt.Sprintf("Using TTL attribute '%s' for table %s", aws.StringValue(description.AttributeName), table))
+	return aws.StringValue(description.AttributeName)
+}
@@ -0,0 +1,710 @@
+package plugins
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amzn/ion-go/ion"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Formats of table snapshots
+const (
+	// Snapshot written by the extension itself
+	SnapshotFormatExtension = "extension"
+	// Native DynamoDB export to S3 in DynamoDB JSON or ION, the key is its manifest-summary.json
+	SnapshotFormatExport = "export"
+)
+
+// Version of the snapshot format written by the extension
+const snapshotVersion = 1
+
+// Lambda environment variable overriding the location of the snapshot bundled with the function
+const SnapshotFile = "CACHE_EXTENSION_SNAPSHOT_FILE"
+
+// Lambda environment variable bounding every read and write of a snapshot in S3, e.g. 1m
+const SnapshotTimeout = "CACHE_EXTENSION_SNAPSHOT_TIMEOUT"
+
+// Snapshot written by the snapshot command and deployed next to cache.yaml
+const DefaultSnapshotFile = "/var/task/cache.snapshot"
+
+// Tables loaded from the bundled snapshot, they are not loaded again on startup
+var bundledTables = make(map[string]bool)
+
+// Struct to store the snapshot configuration of a table
+type DynamoDbSnapshot struct {
+	Bucket           string `yaml:"bucket"`
+	Key              string `yaml:"key"`
+	Format           string `yaml:"format"`
+	ExportInterval   string `yaml:"exportInterval"`
+	ExportOnShutdown bool   `yaml:"exportOnShutdown"`
+
+	exportInterval time.Duration
+}
+
+// Line in front of the items of a table in a snapshot written by the extension
+type snapshotHeader struct {
+	Version   int       `json:"version"`
+	Table     string    `json:"table"`
+	CreatedAt time.Time `json:"createdAt"`
+	Items     int       `json:"items"`
+}
+
+// Item of a snapshot written by the extension
+type snapshotItem struct {
+	FetchedAt time.Time       `json:"fetchedAt"`
+	Item      json.RawMessage `json:"item"`
+	// Expiry of the TTL attribute, which is not part of items whose fields leave it out
+	HardExpiry *time.Time `json:"hardExpiry,omitempty"`
+}
+
+// Summary of a native DynamoDB export
+type exportSummary struct {
+	ExportTime         time.Time `json:"exportTime"`
+	ManifestFilesS3Key string    `json:"manifestFilesS3Key"`
+	OutputFormat       string    `json:"outputFormat"`
+}
+
+// Validate the snapshot configuration of a table
+func initSnapshot(config DynamoDbConfiguration) error {
+	snapshot := config.Snapshot
+	if snapshot == nil {
+		return nil
+	}
+	if snapshot.Bucket == "" || snapshot.Key == "" {
+		return fmt.Errorf("bucket and key are required")
+	}
+	if snapshot.Format == "" {
+		snapshot.Format = SnapshotFormatExtension
+	}
+	if snapshot.Format != SnapshotFormatExtension && snapshot.Format != SnapshotFormatExport {
+		return fmt.Errorf("unknown format '%s'", snapshot.Format)
+	}
+
+	interval, err := ParseTtl(snapshot.ExportInterval)
+	if err != nil {
+		return fmt.Errorf("exportInterval: %w", err)
+	}
+	// Native exports are only read, snapshots are written in the extension's format
+	if (interval > 0 || snapshot.ExportOnShutdown) && snapshot.Format != SnapshotFormatExtension {
+		return fmt.Errorf("only snapshots in the %s format can be exported", SnapshotFormatExtension)
+	}
+	snapshot.exportInterval = interval
+	return nil
+}
+
+// Load the snapshot of a table from S3 into the cache
+func LoadSnapshot(config DynamoDbConfiguration) error {
+	snapshot := config.Snapshot
+	body, err := getSnapshotObject(config, snapshot.Key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	start := time.Now()
+	var count int
+	if snapshot.Format == SnapshotFormatExport {
+		count, err = readExport(config, body)
+	} else {
+		var counts map[string]int
+		counts, err = ReadSnapshot(body, map[string]DynamoDbConfiguration{config.Table: config})
+		if _, ok := counts[config.Table]; err == nil && !ok {
+			err = fmt.Errorf("snapshot does not contain table %s", config.Table)
+		}
+		count = counts[config.Table]
+	}
+	if err != nil {
+		return err
+	}
+
+	println(PrintPrefix, fmt.Sprintf("Loaded %d items of table %s from s3://%s/%s in %s",
+		count, config.Table, snapshot.Bucket, snapshot.Key, time.Since(start)))
+	return nil
+}
+
+// Load the snapshot bundled with the function, if there is one, as the baseline of the configured tables
+func loadBundledSnapshot() {
+	bundledTables = make(map[string]bool)
+	path := os.Getenv(SnapshotFile)
+	if path == "" {
+		path = DefaultSnapshotFile
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		println(PrintPrefix, fmt.Sprintf("Could not open snapshot %s: %s", path, err))
+		return
+	}
+	defer file.Close()
+
+	// The bundled snapshot is as old as the deployment and its tables are not loaded again, so its
+	// items expire one TTL after they were loaded
+	start := time.Now()
+	counts, err := readSnapshot(file, initializedConfig, start)
+	if err != nil {
+		// Tables read partially are loaded again on startup
+		println(PrintPrefix, fmt.Sprintf("Could not read snapshot %s: %s", path, err))
+		return
+	}
+	for table, count := range counts {
+		bundledTables[table] = true
+		println(PrintPrefix, fmt.Sprintf("Loaded %d items of table %s from %s", count, table, path))
+	}
+	println(PrintPrefix, fmt.Sprintf("Loaded snapshot %s in %s", path, time.Since(start)))
+}
+
+// Scan the tables of a configuration to write a snapshot of them, returns the scanned tables
+func ScanDynamoDbTables(configs []DynamoDbConfiguration) ([]string, error) {
+	if err := InitDynamodb(configs, false); err != nil {
+		return nil, err
+	}
+
+	tables := make([]string, 0, len(configs))
+	for _, config := range configs {
+		if !LoadData(initializedConfig[config.Table]) {
+			return nil, fmt.Errorf("could not scan table %s", config.Table)
+		}
+		tables = append(tables, config.Table)
+	}
+	return tables, nil
+}
+
+// Read a snapshot written by the extension and add the items of the configured tables to the
+// cache. Returns the number of items read per table
+func ReadSnapshot(r io.Reader, configs map[string]DynamoDbConfiguration) (map[string]int, error) {
+	return readSnapshot(r, configs, time.Time{})
+}
+
+// Read a snapshot, items count as read at loadedAt when it is set instead of when they were
+// written to the snapshot
+func readSnapshot(r io.Reader, configs map[string]DynamoDbConfiguration, loadedAt time.Time) (map[string]int, error) {
+	counts := make(map[string]int)
+	reader, err := decompress(r)
+	if err != nil {
+		return counts, err
+	}
+
+	decoder := json.NewDecoder(reader)
+	for {
+		var header snapshotHeader
+		err := decoder.Decode(&header)
+		if err == io.EOF {
+			return counts, nil
+		}
+		if err != nil {
+			return counts, fmt.Errorf("invalid snapshot header: %w", err)
+		}
+		if header.Version != snapshotVersion {
+			return counts, fmt.Errorf("unsupported snapshot version %d", header.Version)
+		}
+
+		// Items of tables which are not configured are skipped
+		config, ok := configs[header.Table]
+		if ok {
+			counts[header.Table] = 0
+		}
+		for i := 0; i < header.Items; i++ {
+			var entry snapshotItem
+			if err := decoder.Decode(&entry); err != nil {
+				return counts, fmt.Errorf("invalid snapshot item of table %s: %w", header.Table, err)
+			}
+			if !ok {
+				continue
+			}
+
+			var item map[string]interface{}
+			if err := json.Unmarshal(entry.Item, &item); err != nil {
+				return counts, fmt.Errorf("invalid snapshot item of table %s: %w", header.Table, err)
+			}
+			if _, ok := item[config.TtlAttribute]; !ok && entry.HardExpiry != nil && config.TtlAttribute != "" {
+				item[config.TtlAttribute] = float64(entry.HardExpiry.Unix())
+			}
+			fetchedAt := entry.FetchedAt
+			if !loadedAt.IsZero() {
+				fetchedAt = loadedAt
+			}
+			cacheItem(config, item, fetchedAt)
+			counts[header.Table]++
+		}
+	}
+}
+
+// Write the cached items of tables as a snapshot, returns the number of items written
+func WriteSnapshot(w io.Writer, tables ...string) (int, error) {
+	writer := gzip.NewWriter(w)
+	encoder := json.NewEncoder(writer)
+
+	count := 0
+	for _, table := range tables {
+		entries := dynamoDbTableEntries(table)
+		header := snapshotHeader{Version: snapshotVersion, Table: table, CreatedAt: time.Now(), Items: len(entries)}
+		if err := encoder.Encode(header); err != nil {
+			return count, err
+		}
+
+		for _, dbCache := range entries {
+			entry := snapshotItem{FetchedAt: dbCache.Data.FetchedAt, Item: json.RawMessage(dbCache.Data.Data)}
+			if hardExpiry := dbCache.Data.HardExpiry; !hardExpiry.IsZero() {
+				entry.HardExpiry = &hardExpiry
+			}
+			if err := encoder.Encode(entry); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, writer.Close()
+}
+
+// Return the cached items of a table in memory and on disk, items which passed their TTL
+// attribute are left out
+func dynamoDbTableEntries(table string) map[string]DynamoDbCache {
+	return dynamoDbEntries(table + "@@")
+}
+
+// Return the cached items whose name starts with a prefix, in memory and on disk
+func dynamoDbEntries(prefix string) map[string]DynamoDbCache {
+	entries := make(map[string]DynamoDbCache)
+	forEachDiskEntry(prefix, func(name string, dbCache DynamoDbCache) {
+		entries[name] = dbCache
+	})
+
+	// Memory holds the most recent copies
+	dynamoDbCacheMu.Lock()
+	for name, entry := range dynamoDbSpilling {
+		if strings.HasPrefix(name, prefix) {
+			entries[name] = entry.cache
+		}
+	}
+	for name, element := range dynamoDbCache {
+		if strings.HasPrefix(name, prefix) {
+			entries[name] = element.Value.(*dynamoDbCacheEntry).cache
+		}
+	}
+	dynamoDbCacheMu.Unlock()
+
+	for name, dbCache := range entries {
+		hardExpiry := dbCache.Data.HardExpiry
+		if dbCache.Data.Data == "" || (!hardExpiry.IsZero() && IsExpired(hardExpiry)) {
+			delete(entries, name)
+		}
+	}
+	return entries
+}
+
+// Write the snapshot of a table to S3
+func ExportSnapshot(config DynamoDbConfiguration) error {
+	return exportSnapshot(context.Background(), config)
+}
+
+// Write the snapshot of a table to S3 within the snapshot timeout and the deadline of parent
+func exportSnapshot(parent context.Context, config DynamoDbConfiguration) error {
+	snapshot := config.Snapshot
+	var buffer bytes.Buffer
+	count, err := WriteSnapshot(&buffer, config.Table)
+	if err != nil {
+		return err
+	}
+
+	client, err := GetS3Client(config.AwsConfiguration)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := snapshotContext(parent)
+	defer cancel()
+	_, err = client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:          aws.String(snapshot.Bucket),
+		Key:             aws.String(snapshot.Key),
+		Body:            bytes.NewReader(buffer.Bytes()),
+		ContentType:     aws.String("application/x-ndjson"),
+		ContentEncoding: aws.String("gzip"),
+	})
+	if err != nil {
+		return err
+	}
+
+	println(PrintPrefix, fmt.Sprintf("Exported %d items of table %s to s3://%s/%s", count, config.Table, snapshot.Bucket, snapshot.Key))
+	return nil
+}
+
+// Write the snapshots of the tables configured to export on shutdown before the deadline of the
+// SHUTDOWN event in unix milliseconds, zero if unknown
+func ExportSnapshotsOnShutdown(deadlineMs int64) {
+	parent := context.Background()
+	if deadlineMs > 0 {
+		var cancel context.CancelFunc
+		parent, cancel = context.WithDeadline(parent, time.UnixMilli(deadlineMs).Add(-deadlineMargin))
+		defer cancel()
+	}
+
+	for table, config := range initializedConfig {
+		if config.Snapshot == nil || !config.Snapshot.ExportOnShutdown {
+			continue
+		}
+		if err := exportSnapshot(parent, config); err != nil {
+			println(PrintPrefix, fmt.Sprintf("Could not export snapshot of table %s: %s", table, err))
+		}
+	}
+}
+
+// Write the snapshot of a table on its export interval
+func exportSnapshotPeriodically(config DynamoDbConfiguration) {
+	ticker := time.NewTicker(config.Snapshot.exportInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := ExportSnapshot(config); err != nil {
+			println(PrintPrefix, fmt.Sprintf("Could not export snapshot of table %s: %s", config.Table, err))
+		}
+	}
+}
+
+// Return a context bound to CACHE_EXTENSION_SNAPSHOT_TIMEOUT, shortened to the deadline of parent
+func snapshotContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, getDurationEnv(SnapshotTimeout, time.Minute))
+}
+
+// Body of a snapshot object which releases its context when closed
+type snapshotBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b snapshotBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// Read an object of a snapshot from S3, the caller closes the body. Reading the body is bound to
+// the snapshot timeout as well
+func getSnapshotObject(config DynamoDbConfiguration, key string) (io.ReadCloser, error) {
+	client, err := GetS3Client(config.AwsConfiguration)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := snapshotContext(context.Background())
+	result, err := client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(config.Snapshot.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("could not read s3://%s/%s: %w", config.Snapshot.Bucket, key, err)
+	}
+	return snapshotBody{ReadCloser: result.Body, cancel: cancel}, nil
+}
+
+// Read a native DynamoDB export given its manifest summary and add its items to the cache
+func readExport(config DynamoDbConfiguration, summaryBody io.Reader) (int, error) {
+	var summary exportSummary
+	if err := json.NewDecoder(summaryBody).Decode(&summary); err != nil {
+		return 0, fmt.Errorf("invalid export summary: %w", err)
+	}
+
+	manifestKey := summary.ManifestFilesS3Key
+	if manifestKey == "" {
+		manifestKey = path.Join(path.Dir(config.Snapshot.Key), "manifest-files.json")
+	}
+	manifest, err := getSnapshotObject(config, manifestKey)
+	if err != nil {
+		return 0, err
+	}
+	defer manifest.Close()
+
+	// The manifest lists one data file per line
+	var dataKeys []string
+	decoder := json.NewDecoder(manifest)
+	for {
+		var file struct {
+			DataFileS3Key string `json:"dataFileS3Key"`
+		}
+		err := decoder.Decode(&file)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("invalid export manifest: %w", err)
+		}
+		dataKeys = append(dataKeys, file.DataFileS3Key)
+	}
+
+	count := 0
+	for _, dataKey := range dataKeys {
+		body, err := getSnapshotObject(config, dataKey)
+		if err != nil {
+			return count, err
+		}
+		items, err := ReadExportData(config, summary.OutputFormat, summary.ExportTime, body)
+		body.Close()
+		count += items
+		if err != nil {
+			return count, fmt.Errorf("%s: %w", dataKey, err)
+		}
+	}
+	return count, nil
+}
+
+// Read a data file of a native DynamoDB export in DYNAMODB_JSON or ION and add its items to the cache
+func ReadExportData(config DynamoDbConfiguration, format string, exportTime time.Time, r io.Reader) (int, error) {
+	reader, err := decompress(r)
+	if err != nil {
+		return 0, err
+	}
+
+	var next func() (map[string]*dynamodb.AttributeValue, error)
+	switch format {
+	case "", "DYNAMODB_JSON":
+		decoder := json.NewDecoder(reader)
+		next = func() (map[string]*dynamodb.AttributeValue, error) {
+			var line struct {
+				Item map[string]*dynamodb.AttributeValue
+			}
+			err := decoder.Decode(&line)
+			return line.Item, err
+		}
+	case "ION":
+		ionReader := ion.NewReader(reader)
+		next = func() (map[string]*dynamodb.AttributeValue, error) {
+			for ionReader.Next() {
+				// Version markers in front of every item are read as symbols
+				if ionReader.Type() == ion.StructType {
+					return ionExportItem(ionReader)
+				}
+			}
+			if ionReader.Err() != nil {
+				return nil, ionReader.Err()
+			}
+			return nil, io.EOF
+		}
+	default:
+		return 0, fmt.Errorf("unsupported export format %s", format)
+	}
+
+	count := 0
+	for {
+		attributes, err := next()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+
+		var item map[string]interface{}
+		if err := dynamodbattribute.UnmarshalMap(attributes, &item); err != nil {
+			return count, err
+		}
+		cacheItem(config, projectItem(config, item), exportTime)
+		count++
+	}
+}
+
+// Apply the projection of a table to an item of an export which holds all attributes
+func projectItem(config DynamoDbConfiguration, item map[string]interface{}) map[string]interface{} {
+	fields := projectionFields(config)
+	if fields == "" {
+		return item
+	}
+
+	projected := make(map[string]interface{})
+	for _, field := range append(strings.Split(fields, ","), config.HashKey, config.SortKey) {
+		if value, ok := item[field]; ok {
+			projected[field] = value
+		}
+	}
+	return projected
+}
+
+// Decompress gzip data, other data is returned as is
+func decompress(r io.Reader) (io.Reader, error) {
+	reader := bufio.NewReader(r)
+	magic, err := reader.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(reader)
+	}
+	return reader, nil
+}
+
+// Convert the top-level struct {Item: {...}} of an ION export to an item
+func ionExportItem(reader ion.Reader) (map[string]*dynamodb.AttributeValue, error) {
+	if err := reader.StepIn(); err != nil {
+		return nil, err
+	}
+	var item map[string]*dynamodb.AttributeValue
+	for reader.Next() {
+		name, err := reader.FieldName()
+		if err != nil {
+			return nil, err
+		}
+		if name == nil || name.Text == nil || *name.Text != "Item" {
+			continue
+		}
+		value, err := ionAttributeValue(reader)
+		if err != nil {
+			return nil, err
+		}
+		item = value.M
+	}
+	if err := reader.Err(); err != nil {
+		return nil, err
+	}
+	return item, reader.StepOut()
+}
+
+// Convert an ION value of an export to an attribute value. Sets are lists annotated with
+// $dynamodb_SS, $dynamodb_NS or $dynamodb_BS
+func ionAttributeValue(reader ion.Reader) (*dynamodb.AttributeValue, error) {
+	if reader.IsNull() {
+		return &dynamodb.AttributeValue{NULL: aws.Bool(true)}, nil
+	}
+
+	switch reader.Type() {
+	case ion.BoolType:
+		value, err := reader.BoolValue()
+		if err != nil {
+			return nil, err
+		}
+		return &dynamodb.AttributeValue{BOOL: value}, nil
+	case ion.IntType, ion.FloatType, ion.DecimalType:
+		number, err := ionNumber(reader)
+		if err != nil {
+			return nil, err
+		}
+		return &dynamodb.AttributeValue{N: aws.String(number)}, nil
+	case ion.StringType, ion.SymbolType:
+		value, err := reader.StringValue()
+		if err != nil {
+			return nil, err
+		}
+		return &dynamodb.AttributeValue{S: value}, nil
+	case ion.BlobType, ion.ClobType:
+		value, err := reader.ByteValue()
+		if err != nil {
+			return nil, err
+		}
+		return &dynamodb.AttributeValue{B: value}, nil
+	case ion.StructType:
+		attributes := make(map[string]*dynamodb.AttributeValue)
+		err := ionContainer(reader, func() error {
+			name, err := reader.FieldName()
+			if err != nil || name == nil || name.Text == nil {
+				return err
+			}
+			value, err := ionAttributeValue(reader)
+			attributes[*name.Text] = value
+			return err
+		})
+		return &dynamodb.AttributeValue{M: attributes}, err
+	case ion.ListType, ion.SexpType:
+		annotations, err := reader.Annotations()
+		if err != nil {
+			return nil, err
+		}
+		set := ""
+		for _, annotation := range annotations {
+			if annotation.Text != nil && strings.HasPrefix(*annotation.Text, "$dynamodb_") {
+				set = strings.TrimPrefix(*annotation.Text, "$dynamodb_")
+			}
+		}
+
+		var values []*dynamodb.AttributeValue
+		err = ionContainer(reader, func() error {
+			value, err := ionAttributeValue(reader)
+			values = append(values, value)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		result := &dynamodb.AttributeValue{}
+		switch set {
+		case "SS":
+			for _, value := range values {
+				result.SS = append(result.SS, value.S)
+			}
+		case "NS":
+			for _, value := range values {
+				result.NS = append(result.NS, value.N)
+			}
+		case "BS":
+			for _, value := range values {
+				result.BS = append(result.BS, value.B)
+			}
+		default:
+			result.L = values
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("unsupported ion value of type %s", reader.Type())
+	}
+}
+
+// Call fn for every value of an ION struct or list
+func ionContainer(reader ion.Reader, fn func() error) error {
+	if err := reader.StepIn(); err != nil {
+		return err
+	}
+	for reader.Next() {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	if err := reader.Err(); err != nil {
+		return err
+	}
+	return reader.StepOut()
+}
+
+// Format an ION number as a Dynamodb number
+func ionNumber(reader ion.Reader) (string, error) {
+	switch reader.Type() {
+	case ion.IntType:
+		value, err := reader.BigIntValue()
+		if err != nil {
+			return "", err
+		}
+		return value.String(), nil
+	case ion.FloatType:
+		value, err := reader.FloatValue()
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatFloat(*value, 'g', -1, 64), nil
+	default:
+		value, err := reader.DecimalValue()
+		if err != nil {
+			return "", err
+		}
+		coefficient, exponent := value.CoEx()
+		return decimalString(coefficient, exponent), nil
+	}
+}
+
+// Format coefficient * 10^exponent in scientific notation understood by Dynamodb
+func decimalString(coefficient *big.Int, exponent int32) string {
+	if exponent == 0 {
+		return coefficient.String()
+	}
+	return coefficient.String() + "E" + strconv.Itoa(int(exponent))
+}
@@ -0,0 +1,240 @@
+package plugins
+
+import (
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+type fakeS3Client struct {
+	s3iface.S3API
+	objects map[string][]byte
+	// Deadline of every call
+	deadlines []time.Time
+}
+
+func (f *fakeS3Client) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+	deadline, _ := ctx.Deadline()
+	f.deadlines = append(f.deadlines, deadline)
+	data, ok := f.objects[aws.StringValue(input.Key)]
+	if !ok {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (f *fakeS3Client) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, _ ...request.Option) (*s3.PutObjectOutput, error) {
+	deadline, _ := ctx.Deadline()
+	f.deadlines = append(f.deadlines, deadline)
+	data, err := io.ReadAll(input.Body)
+	f.objects[aws.StringValue(input.Key)] = data
+	return &s3.PutObjectOutput{}, err
+}
+
+// Empty the in-memory Dynamodb cache for the duration of a test
+func resetDynamoDbCache(t *testing.T) {
+	dynamoDbCache, dynamoDbLru, dynamoDbCacheBytes = make(map[string]*list.Element), list.New(), 0
+	dynamoDbSpilling = make(map[string]*dynamoDbCacheEntry)
+	t.Cleanup(func() {
+		dynamoDbCache, dynamoDbLru, dynamoDbCacheBytes = make(map[string]*list.Element), list.New(), 0
+		dynamoDbSpilling = make(map[string]*dynamoDbCacheEntry)
+	})
+}
+
+func gzipLines(lines ...string) []byte {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	_, _ = writer.Write([]byte(strings.Join(lines, "\n") + "\n"))
+	_ = writer.Close()
+	return buffer.Bytes()
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	t.Setenv(CacheTimeOut, "10m")
+	resetDynamoDbCache(t)
+
+	config := DynamoDbConfiguration{Table: "snap", HashKey: "pk", HashKeyType: "S", TtlAttribute: "expiresAt"}
+	cacheItem(config, map[string]interface{}{"pk": "a", "value": 1.5}, time.Now())
+	cacheItem(config, map[string]interface{}{"pk": "b", "value": "old"}, time.Now().Add(-8*time.Minute))
+	// Items past their TTL attribute are not exported
+	expired := float64(time.Now().Add(-time.Minute).Unix())
+	setDynamoDbCache("snap@@c", DynamoDbCache{Data: CacheData{Data: `{"pk":"c"}`, HardExpiry: time.Unix(int64(expired), 0)}})
+
+	var snapshot bytes.Buffer
+	other := DynamoDbConfiguration{Table: "other", HashKey: "id", HashKeyType: "S"}
+	cacheItem(other, map[string]interface{}{"id": "x"}, time.Now())
+
+	count, err := WriteSnapshot(&snapshot, "snap", "other")
+	if err != nil || count != 3 {
+		t.Fatalf("Expected 3 items to be written. Got %d, %v", count, err)
+	}
+
+	// Items of tables which are not configured are skipped
+	resetDynamoDbCache(t)
+	counts, err := ReadSnapshot(bytes.NewReader(snapshot.Bytes()), map[string]DynamoDbConfiguration{"snap": config})
+	if err != nil || counts["snap"] != 2 || len(counts) != 1 {
+		t.Fatalf("Expected 2 items to be read. Got %v, %v", counts, err)
+	}
+	if _, ok := getDynamoDbCache("other@@x"); ok {
+		t.Error("Expected item of other table to be skipped")
+	}
+	a, _ := getDynamoDbCache("snap@@a")
+	if a.Data.Data != `{"pk":"a","value":1.5}` || a.Config.HashKeyValue != "a" {
+		t.Errorf("Unexpected item %+v", a)
+	}
+	// The item keeps the time it was read, so it expires one TTL later
+	b, _ := getDynamoDbCache("snap@@b")
+	if time.Until(b.Data.CacheExpiry) > 3*time.Minute {
+		t.Errorf("Expected item read 8 minutes ago to expire within 2 minutes. Got %s", b.Data.CacheExpiry)
+	}
+
+	if _, err := ReadSnapshot(strings.NewReader(`{"version":2,"table":"snap"}`), nil); err == nil {
+		t.Error("Expected snapshot of an unknown version to be rejected")
+	}
+}
+
+func TestLoadExport(t *testing.T) {
+	resetDynamoDbCache(t)
+
+	exportTime := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	client := &fakeS3Client{objects: map[string][]byte{
+		"AWSDynamoDB/01/manifest-summary.json": []byte(`{"exportTime":"` + exportTime + `","manifestFilesS3Key":"AWSDynamoDB/01/manifest-files.json","outputFormat":"DYNAMODB_JSON"}`),
+		"AWSDynamoDB/01/manifest-files.json": []byte(`{"itemCount":1,"dataFileS3Key":"AWSDynamoDB/01/data/1.json.gz"}
+{"itemCount":1,"dataFileS3Key":"AWSDynamoDB/01/data/2.json.gz"}`),
+		"AWSDynamoDB/01/data/1.json.gz": gzipLines(`{"Item":{"pk":{"S":"a"},"sk":{"N":"1"},"name":{"S":"Book"},"secret":{"S":"x"}}}`),
+		"AWSDynamoDB/01/data/2.json.gz": gzipLines(`{"Item":{"pk":{"S":"b"},"sk":{"N":"2"},"name":{"S":"Pen"},"tags":{"SS":["blue"]}}}`),
+	}}
+	config := DynamoDbConfiguration{
+		Table: "export", HashKey: "pk", HashKeyType: "S", SortKey: "sk", SortKeyType: "N", Fields: "pk,sk,name,tags",
+		Snapshot:         &DynamoDbSnapshot{Bucket: "exports", Key: "AWSDynamoDB/01/manifest-summary.json", Format: SnapshotFormatExport},
+		AwsConfiguration: AwsConfiguration{Region: "export-test"},
+	}
+	defer s3Clients.delete(config.AwsConfiguration)
+	s3Clients.set(config.AwsConfiguration, client)
+
+	if err := initSnapshot(config); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if err := LoadSnapshot(config); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if a, _ := getDynamoDbCache("export@@a@@1"); a.Data.Data != `{"name":"Book","pk":"a","sk":1}` {
+		t.Errorf("Expected projected item of the first data file. Got %+v", a.Data)
+	}
+	if b, _ := getDynamoDbCache("export@@b@@2"); b.Data.Data != `{"name":"Pen","pk":"b","sk":2,"tags":["blue"]}` {
+		t.Errorf("Expected item of the second data file. Got %+v", b.Data)
+	}
+
+	// Only snapshots in the extension's format can be written
+	config.Snapshot.ExportOnShutdown = true
+	if err := initSnapshot(config); err == nil {
+		t.Error("Expected exporting a native export to be rejected")
+	}
+}
+
+func TestSnapshotDeadlines(t *testing.T) {
+	t.Setenv(SnapshotTimeout, "1m")
+	resetDynamoDbCache(t)
+	previous := initializedConfig
+	defer func() { initializedConfig = previous }()
+
+	client := &fakeS3Client{objects: map[string][]byte{}}
+	config := DynamoDbConfiguration{
+		Table: "shutdown", HashKey: "pk", HashKeyType: "S",
+		Snapshot:         &DynamoDbSnapshot{Bucket: "snapshots", Key: "shutdown.ndjson.gz", Format: SnapshotFormatExtension, ExportOnShutdown: true},
+		AwsConfiguration: AwsConfiguration{Region: "shutdown-test"},
+	}
+	defer s3Clients.delete(config.AwsConfiguration)
+	s3Clients.set(config.AwsConfiguration, client)
+	initializedConfig = map[string]DynamoDbConfiguration{"shutdown": config}
+	cacheItem(config, map[string]interface{}{"pk": "a"}, time.Now())
+
+	// The export on shutdown ends before the deadline of the SHUTDOWN event
+	shutdownDeadline := time.Now().Add(2 * time.Second)
+	ExportSnapshotsOnShutdown(shutdownDeadline.UnixMilli())
+	if len(client.deadlines) != 1 || client.deadlines[0].After(shutdownDeadline) {
+		t.Fatalf("Expected the export to be bound to the shutdown deadline. Got %v", client.deadlines)
+	}
+
+	// Reads are bound to the snapshot timeout
+	body, err := getSnapshotObject(config, config.Snapshot.Key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	body.Close()
+	if deadline := client.deadlines[1]; deadline.IsZero() || time.Until(deadline) > time.Minute {
+		t.Errorf("Expected the read to be bound to the snapshot timeout. Got %s", deadline)
+	}
+}
+
+func TestReadIonExport(t *testing.T) {
+	resetDynamoDbCache(t)
+
+	config := DynamoDbConfiguration{Table: "ion", HashKey: "pk", HashKeyType: "S"}
+	data := gzipLines(
+		`$ion_1_0 {Item:{pk:"a",price:15d-1,count:3,active:true,tags:$dynamodb_SS::["x","y"],nested:{list:[1.,"two"]},missing:null}}`,
+		`$ion_1_0 {Item:{pk:"b",data:{{aGVsbG8=}}}}`,
+	)
+	count, err := ReadExportData(config, "ION", time.Now(), bytes.NewReader(data))
+	if err != nil || count != 2 {
+		t.Fatalf("Expected 2 items. Got %d, %v", count, err)
+	}
+
+	a, _ := getDynamoDbCache("ion@@a")
+	expected := `{"active":true,"count":3,"missing":null,"nested":{"list":[1,"two"]},"pk":"a","price":1.5,"tags":["x","y"]}`
+	if a.Data.Data != expected {
+		t.Errorf("Expected %s. Got %s", expected, a.Data.Data)
+	}
+	if b, _ := getDynamoDbCache("ion@@b"); b.Data.Data != `{"data":"aGVsbG8=","pk":"b"}` {
+		t.Errorf("Expected binary attribute. Got %s", b.Data.Data)
+	}
+}
+
+func TestLoadBundledSnapshot(t *testing.T) {
+	t.Setenv(CacheTimeOut, "10m")
+	resetDynamoDbCache(t)
+	config := DynamoDbConfiguration{Table: "bundled", HashKey: "pk", HashKeyType: "S"}
+	// The snapshot was built long before the function started
+	cacheItem(config, map[string]interface{}{"pk": "a"}, time.Now().Add(-2*time.Hour))
+
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	var snapshot bytes.Buffer
+	if _, err := WriteSnapshot(&snapshot, "bundled"); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if err := os.WriteFile(path, snapshot.Bytes(), 0o600); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	resetDynamoDbCache(t)
+	t.Setenv(SnapshotFile, path)
+	previous := initializedConfig
+	defer func() { initializedConfig = previous }()
+	initializedConfig = map[string]DynamoDbConfiguration{"bundled": config, "scanned": {Table: "scanned"}}
+
+	loadBundledSnapshot()
+	if !bundledTables["bundled"] || bundledTables["scanned"] {
+		t.Errorf("Expected only the bundled table to be loaded. Got %v", bundledTables)
+	}
+	if result, _ := FetchDynamoDbCache("bundled@@a"); result.Data != `{"pk":"a"}` || result.Status != CacheHit {
+		t.Errorf("Expected item of a snapshot older than the TTL to be served from the cache. Got %+v", result)
+	}
+
+	// Without a bundled snapshot every table is loaded on startup
+	t.Setenv(SnapshotFile, filepath.Join(t.TempDir(), "missing"))
+	loadBundledSnapshot()
+	if len(bundledTables) != 0 {
+		t.Errorf("Expected no bundled tables. Got %v", bundledTables)
+	}
+}
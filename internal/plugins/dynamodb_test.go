@@ -1,9 +1,18 @@
 package plugins
 
 import (
+	"errors"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 	"gopkg.in/yaml.v2"
 )
 
@@ -57,8 +66,270 @@ func TestGetData(t *testing.T) {
 		t.Fatalf("Failed to read config file %s. Error: %s", configFilePath, err)
 	}
 	result := LoadData(*config)
-    
+
 	if result == false {
 		t.Error("Expected data existing. Got empty data")
 	}
 }
+
+func TestGetItemExpiry(t *testing.T) {
+	config := DynamoDbConfiguration{Table: "table", TtlAttribute: "expiresAt"}
+	cacheExpiry := GetCacheExpiry()
+
+	past := float64(time.Now().Add(-time.Minute).Unix())
+	if !IsExpired(GetItemExpiry(config, map[string]interface{}{"expiresAt": past})) {
+		t.Error("Expected item with past TTL to be expired")
+	}
+
+	soon := time.Now().Add(time.Minute).Unix()
+	expiry := GetItemExpiry(config, map[string]interface{}{"expiresAt": float64(soon)})
+	if expiry.Unix() != soon {
+		t.Errorf("Expected expiry %d. Got %d", soon, expiry.Unix())
+	}
+
+	later := float64(cacheExpiry.Add(time.Hour).Unix())
+	expiry = GetItemExpiry(config, map[string]interface{}{"expiresAt": later})
+	if expiry.After(GetCacheExpiry()) {
+		t.Error("Expected expiry to be capped by the cache TTL")
+	}
+
+	expiry = GetItemExpiry(config, map[string]interface{}{})
+	if IsExpired(expiry) {
+		t.Error("Expected item without TTL attribute to use the cache TTL")
+	}
+}
+
+type fakeDynamoDbClient struct {
+	dynamodbiface.DynamoDBAPI
+	table *dynamodb.TableDescription
+	// Items by the string value of their hash key
+	items    map[string]map[string]*dynamodb.AttributeValue
+	getItems int
+}
+
+func (f *fakeDynamoDbClient) DescribeTableWithContext(aws.Context, *dynamodb.DescribeTableInput, ...request.Option) (*dynamodb.DescribeTableOutput, error) {
+	return &dynamodb.DescribeTableOutput{Table: f.table}, nil
+}
+
+func (f *fakeDynamoDbClient) GetItemWithContext(_ aws.Context, input *dynamodb.GetItemInput, _ ...request.Option) (*dynamodb.GetItemOutput, error) {
+	f.getItems++
+	for _, value := range input.Key {
+		if item, ok := f.items[aws.StringValue(value.S)]; ok {
+			return &dynamodb.GetItemOutput{Item: item}, nil
+		}
+	}
+	return &dynamodb.GetItemOutput{}, nil
+}
+
+func TestDescribeKeySchema(t *testing.T) {
+	defer dynamoDbClients.delete("table")
+	dynamoDbClients.set("table", &fakeDynamoDbClient{table: &dynamodb.TableDescription{
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String("pk"), AttributeType: aws.String("S")},
+			{AttributeName: aws.String("sk"), AttributeType: aws.String("N")},
+			{AttributeName: aws.String("email"), AttributeType: aws.String("S")},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String("pk"), KeyType: aws.String("HASH")},
+			{AttributeName: aws.String("sk"), KeyType: aws.String("RANGE")},
+		},
+		GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndexDescription{{
+			IndexName: aws.String("by-email"),
+			KeySchema: []*dynamodb.KeySchemaElement{{AttributeName: aws.String("email"), KeyType: aws.String("HASH")}},
+		}},
+	}})
+
+	config := DynamoDbConfiguration{Table: "table"}
+	if err := DescribeKeySchema(&config); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if config.HashKey != "pk" || config.HashKeyType != "S" || config.SortKey != "sk" || config.SortKeyType != "N" {
+		t.Errorf("Unexpected key schema %+v", config)
+	}
+	if len(config.Indexes) != 1 || config.Indexes[0].HashKey != "email" {
+		t.Errorf("Unexpected indexes %+v", config.Indexes)
+	}
+
+	config = DynamoDbConfiguration{Table: "table", HashKey: "id"}
+	if err := DescribeKeySchema(&config); !errors.Is(err, ErrSchemaMismatch) {
+		t.Errorf("Expected an error for a hash key contradicting the table. Got %v", err)
+	}
+}
+
+func TestConfigForCacheKey(t *testing.T) {
+	previous := initializedConfig
+	defer func() { initializedConfig = previous }()
+	initializedConfig = map[string]DynamoDbConfiguration{
+		"users":  {Table: "users", HashKey: "id"},
+		"orders": {Table: "orders", HashKey: "pk", SortKey: "sk"},
+	}
+
+	config, err := configForCacheKey("users@@1")
+	if err != nil || config.HashKeyValue != "1" || config.SortKeyValue != "" {
+		t.Errorf("Expected hash only key to be accepted. Got %+v, %v", config, err)
+	}
+	config, err = configForCacheKey("orders@@a@@2")
+	if err != nil || config.HashKeyValue != "a" || config.SortKeyValue != "2" {
+		t.Errorf("Expected key with sort key to be accepted. Got %+v, %v", config, err)
+	}
+
+	for _, key := range []string{"orders@@a", "users@@1@@2", "users@@", "orders@@@@2"} {
+		if _, err := configForCacheKey(key); !errors.Is(err, ErrInvalidRequest) {
+			t.Errorf("Expected key '%s' to be invalid. Got %v", key, err)
+		}
+	}
+	if _, err := FetchDynamoDbCache("other@@1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected unconfigured table not to be found. Got %v", err)
+	}
+}
+
+func TestDynamoDbQuery(t *testing.T) {
+	resetDynamoDbCache(t)
+	previous := initializedConfig
+	defer func() { initializedConfig = previous }()
+	initializedConfig = map[string]DynamoDbConfiguration{
+		"orders": {Table: "orders", HashKey: "pk", HashKeyType: "S", SortKey: "sk", SortKeyType: "N"},
+	}
+
+	entry := func(data string) DynamoDbCache {
+		return DynamoDbCache{Data: CacheData{Data: data, CacheExpiry: time.Now().Add(time.Minute)}}
+	}
+	setDynamoDbCache("orders@@a@@2", entry(`{"pk":"a","sk":2}`))
+	setDynamoDbCache("orders@@a@@1", entry(`{"pk":"a","sk":1}`))
+	setDynamoDbCache("orders@@ab@@1", entry(`{"pk":"ab","sk":1}`))
+
+	results, err := (&dynamoDbSource{}).Query(CacheRequest{Name: "orders@@a"})
+	if err != nil || len(results) != 2 || results[0].Key != "orders@@a@@1" || results[1].Data != `{"pk":"a","sk":2}` {
+		t.Errorf("Expected the cached items of partition a in key order. Got %+v, %v", results, err)
+	}
+	if _, err := (&dynamoDbSource{}).Query(CacheRequest{Name: "orders@@a@@1"}); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("Expected query with sort key to be invalid. Got %v", err)
+	}
+	if _, err := (&dynamoDbSource{}).Query(CacheRequest{Name: "other@@a"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected query of unconfigured table not to be found. Got %v", err)
+	}
+}
+
+func TestDynamoDbEntryInfo(t *testing.T) {
+	resetDynamoDbCache(t)
+	config := DynamoDbConfiguration{Table: "orders", HashKey: "pk", HashKeyValue: "a", SortKey: "sk", SortKeyValue: "1",
+		AwsConfiguration: AwsConfiguration{ExternalId: "secret"}}
+	data := `{"pk":"a","sk":1}`
+	setDynamoDbCache("orders@@a@@1", DynamoDbCache{
+		Data:   CacheData{Data: data, FetchedAt: time.Now(), CacheExpiry: time.Now().Add(time.Minute)},
+		Config: config,
+	})
+	hits := GetDynamoDbStats("orders").Snapshot().Hits
+
+	for i := 0; i < 2; i++ {
+		if result, err := FetchDynamoDbCache("orders@@a@@1"); err != nil || result.Status != CacheHit {
+			t.Fatalf("Expected a cache hit. Got %+v, %v", result, err)
+		}
+	}
+
+	source := &dynamoDbSource{}
+	info, ok := source.Entry("orders@@a@@1")
+	if !ok || info.Hits != 2 || info.Size != len("orders@@a@@1")+len(data) || info.Tier != TierMemory || info.FetchedAt.IsZero() {
+		t.Errorf("Expected the metadata of the item. Got %+v", info)
+	}
+	if info.Config["hashKeyValue"] != "a" || info.Config["table"] != "orders" {
+		t.Errorf("Expected the configuration of the item. Got %v", info.Config)
+	}
+	if _, ok := info.Config["externalId"]; ok {
+		t.Error("Expected the external id to be left out")
+	}
+	if _, ok := source.Entry("orders@@b@@1"); ok {
+		t.Error("Expected no metadata of an item which is not cached")
+	}
+
+	if usage := source.Usage()["orders"]; usage.Entries != 1 || usage.Bytes != info.Size {
+		t.Errorf("Expected the usage of the table. Got %+v", usage)
+	}
+	if stats := GetDynamoDbStats("orders").Snapshot(); stats.Hits != hits+2 {
+		t.Errorf("Expected 2 more hits of the table. Got %d", stats.Hits-hits)
+	}
+}
+
+func TestTtlAttributeLeftOut(t *testing.T) {
+	resetDynamoDbCache(t)
+	expires := time.Now().Add(time.Hour).Unix()
+	config := DynamoDbConfiguration{Table: "sessions", HashKey: "pk", HashKeyType: "S", Fields: "pk,name", TtlAttribute: "expires"}
+	cacheItem(config, map[string]interface{}{"pk": "a", "name": "x", "expires": float64(expires)}, time.Now())
+
+	dbCache, ok := getDynamoDbCache("sessions@@a")
+	if !ok || dbCache.Data.Data != `{"name":"x","pk":"a"}` {
+		t.Errorf("Expected the TTL attribute not to be served. Got %s", dbCache.Data.Data)
+	}
+	if dbCache.Data.HardExpiry.Unix() != expires {
+		t.Errorf("Expected the expiry of the TTL attribute. Got %s", dbCache.Data.HardExpiry)
+	}
+
+	config.Fields = "pk,name,expires"
+	cacheItem(config, map[string]interface{}{"pk": "b", "name": "y", "expires": float64(expires)}, time.Now())
+	if dbCache, _ := getDynamoDbCache("sessions@@b"); !strings.Contains(dbCache.Data.Data, `"expires"`) {
+		t.Errorf("Expected the TTL attribute to be served when it is one of the fields. Got %s", dbCache.Data.Data)
+	}
+}
+
+func TestClientFailureCached(t *testing.T) {
+	failure := errors.New("could not resolve AWS credentials")
+	dynamoDbClients.failures["table"] = clientFailure{err: failure, until: time.Now().Add(time.Minute)}
+	defer dynamoDbClients.delete("table")
+
+	config := DynamoDbConfiguration{Table: "table"}
+	config.RoleArn = "arn:aws:iam::123456789012:role/reader"
+	if _, err := GetDynamoDbClient(config); err != failure {
+		t.Errorf("Expected the cached failure without assuming the role again. Got %v", err)
+	}
+	if _, ok := dynamoDbClients.clients["table"]; ok {
+		t.Error("Expected no client to be created")
+	}
+}
+
+// Client blocking GetItem until released, counting the calls
+type blockingDynamoDbClient struct {
+	dynamodbiface.DynamoDBAPI
+	release  chan struct{}
+	getItems int32
+}
+
+func (b *blockingDynamoDbClient) GetItemWithContext(aws.Context, *dynamodb.GetItemInput, ...request.Option) (*dynamodb.GetItemOutput, error) {
+	atomic.AddInt32(&b.getItems, 1)
+	<-b.release
+	return &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("a")}}}, nil
+}
+
+func TestConcurrentMissesShareGetItem(t *testing.T) {
+	resetDynamoDbCache(t)
+	client := &blockingDynamoDbClient{release: make(chan struct{})}
+	defer dynamoDbClients.delete("coalesced")
+	dynamoDbClients.set("coalesced", client)
+	previous := initializedConfig
+	defer func() { initializedConfig = previous }()
+	initializedConfig = map[string]DynamoDbConfiguration{
+		"coalesced": {Table: "coalesced", HashKey: "pk", HashKeyType: "S"},
+	}
+
+	var wg sync.WaitGroup
+	results := make([]CacheResult, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = FetchDynamoDbCache("coalesced@@a")
+		}(i)
+	}
+	// Let every lookup reach the origin before it answers
+	time.Sleep(50 * time.Millisecond)
+	close(client.release)
+	wg.Wait()
+
+	if calls := atomic.LoadInt32(&client.getItems); calls != 1 {
+		t.Errorf("Expected concurrent misses to share a single GetItem call. Got %d", calls)
+	}
+	for _, result := range results {
+		if result.Data != `{"pk":"a"}` {
+			t.Errorf("Expected every lookup to get the item. Got %+v", result)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package plugins
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cache type of generic HTTP upstreams
+const Http = "http"
+
+// Responses larger than this are not cached
+const maxHttpResponseSize = 5 * 1024 * 1024
+
+// Struct to store the configuration of an HTTP upstream. The URL may contain path parameters
+// like {id} which are filled from the query parameters of a lookup, header values may
+// reference environment variables like ${API_TOKEN}
+type HttpConfiguration struct {
+	Name    string            `yaml:"name"`
+	Url     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Ttl     string            `yaml:"ttl"`
+
+	ttl time.Duration
+}
+
+// Source serving GET responses of HTTP upstreams
+type httpSource struct {
+	configs map[string]HttpConfiguration
+	cache   *cacheStore
+	client  *http.Client
+}
+
+var urlTemplateParam = regexp.MustCompile(`\{([^{}]+)\}`)
+
+func init() {
+	RegisterSource(Http, &httpSource{
+		configs: make(map[string]HttpConfiguration),
+		cache:   newCacheStore(),
+		client:  &http.Client{},
+	})
+}
+
+// Initialize the upstreams listed in the http section of cache.yaml
+func (s *httpSource) Init(unmarshal func(interface{}) error) error {
+	var configs []HttpConfiguration
+	if err := unmarshal(&configs); err != nil {
+		return err
+	}
+
+	for _, config := range configs {
+		if config.Name == "" || config.Url == "" {
+			return fmt.Errorf("name and url are required for http upstreams")
+		}
+
+		ttl, err := ParseTtl(config.Ttl)
+		if err != nil {
+			return fmt.Errorf("http upstream %s: %w", config.Name, err)
+		}
+		config.ttl = ttl
+		s.configs[config.Name] = config
+	}
+	return nil
+}
+
+// Load every upstream whose URL has no path parameters
+func (s *httpSource) Preload() error {
+	var failed []string
+	for name, config := range s.configs {
+		if urlTemplateParam.MatchString(config.Url) {
+			continue
+		}
+		if _, err := s.Fetch(CacheRequest{Name: name}); err != nil {
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not load http upstreams %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Fetch the response of an upstream, path parameters are taken from the request parameters
+func (s *httpSource) Fetch(request CacheRequest) (CacheResult, error) {
+	config, ok := s.configs[request.Name]
+	if !ok {
+		return CacheResult{}, fmt.Errorf("%w: no http configuration for upstream '%s'", ErrNotFound, request.Name)
+	}
+
+	upstreamUrl, err := expandUrl(config.Url, request.Params)
+	if err != nil {
+		return CacheResult{}, fmt.Errorf("%w for http upstream %s: %s", ErrInvalidRequest, config.Name, err)
+	}
+
+	key := httpCacheKey(config, request.Params)
+	return s.cache.Fetch(key, config.Name, Http+":"+config.Name, request.NoCache, func(cached CacheData) (CacheData, bool, error) {
+		return s.get(config, upstreamUrl, cached)
+	})
+}
+
+// Remove the response of an upstream, or of every path parameter of it when given the upstream name
+func (s *httpSource) Invalidate(name string) {
+	s.cache.DeleteWithParams(name)
+}
+
+func (s *httpSource) Keys(prefix string) []string {
+	return s.cache.KeysWithPrefix(prefix)
+}
+
+func (s *httpSource) Peek(name string) (CacheData, bool) {
+	return s.cache.Get(name)
+}
+
+func (s *httpSource) Stats() map[string]CacheStats {
+	return s.cache.StatsSnapshot()
+}
+
+// Fill the path parameters of a URL template, every parameter must be given
+func expandUrl(template string, params map[string]string) (string, error) {
+	var missing []string
+	expanded := urlTemplateParam.ReplaceAllStringFunc(template, func(match string) string {
+		name := match[1 : len(match)-1]
+		value, ok := params[name]
+		if !ok {
+			missing = append(missing, name)
+			return match
+		}
+		return url.PathEscape(value)
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing path parameters %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// Key of a response, "upstreamName?param=value&..." with the path parameters of the URL only
+func httpCacheKey(config HttpConfiguration, params map[string]string) string {
+	values := url.Values{}
+	for _, match := range urlTemplateParam.FindAllStringSubmatch(config.Url, -1) {
+		values.Set(match[1], params[match[1]])
+	}
+	if len(values) == 0 {
+		return config.Name
+	}
+	return config.Name + "?" + values.Encode()
+}
+
+// Send a GET request to the upstream. When an expired copy is cached the request is
+// conditional, and a 304 response keeps the copy
+func (s *httpSource) get(config HttpConfiguration, upstreamUrl string, cached CacheData) (CacheData, bool, error) {
+	ctx, cancel := OriginContext()
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, upstreamUrl, nil)
+	if err != nil {
+		return CacheData{}, false, err
+	}
+	for header, value := range config.Headers {
+		request.Header.Set(header, os.ExpandEnv(value))
+	}
+	if cached.Data != "" {
+		if cached.OriginETag != "" {
+			request.Header.Set("If-None-Match", cached.OriginETag)
+		}
+		if cached.OriginLastModified != "" {
+			request.Header.Set("If-Modified-Since", cached.OriginLastModified)
+		}
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return CacheData{}, false, err
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusNotModified && cached.Data != "":
+		cached.CacheExpiry = httpCacheExpiry(config, response.Header)
+		cached.FetchedAt = time.Now()
+		cached.NoStore = httpNoStore(response.Header)
+		return cached, true, nil
+	case response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests:
+		return CacheData{}, false, fmt.Errorf("%w: http upstream %s responded with %s", ErrOriginUnavailable, config.Name, response.Status)
+	case response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden:
+		// Rejected credentials, e.g. an expired token in the headers, are not a missing response
+		return CacheData{}, false, fmt.Errorf("%w: http upstream %s rejected the request with %s", ErrOriginUnavailable, config.Name, response.Status)
+	case response.StatusCode != http.StatusOK:
+		println(PrintPrefix, fmt.Sprintf("Http upstream %s responded with %s for '%s'", config.Name, response.Status, upstreamUrl))
+		return CacheData{}, false, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxHttpResponseSize+1))
+	if err != nil {
+		return CacheData{}, false, err
+	}
+	if len(body) > maxHttpResponseSize {
+		return CacheData{}, false, fmt.Errorf("%w: response of http upstream %s exceeds %d bytes", ErrTooLarge, config.Name, maxHttpResponseSize)
+	}
+
+	return CacheData{
+		Data:               string(body),
+		CacheExpiry:        httpCacheExpiry(config, response.Header),
+		FetchedAt:          time.Now(),
+		ContentType:        response.Header.Get("Content-Type"),
+		OriginETag:         response.Header.Get("ETag"),
+		OriginLastModified: response.Header.Get("Last-Modified"),
+		NoStore:            httpNoStore(response.Header),
+	}, true, nil
+}
+
+// Return the cache expiry of a response. Cache-Control max-age of the upstream wins over the
+// configured TTL, no-cache responses are revalidated on every lookup
+func httpCacheExpiry(config HttpConfiguration, header http.Header) time.Time {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-cache":
+			return time.Now()
+		case strings.HasPrefix(directive, "max-age="):
+			seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+			if err == nil {
+				return time.Now().Add(time.Duration(seconds) * time.Second)
+			}
+		}
+	}
+	return GetCacheExpiryFor(config.ttl)
+}
+
+// Check whether a response must not be cached at all
+func httpNoStore(header http.Header) bool {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package plugins
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestHttpFetch(t *testing.T) {
+	t.Setenv("RATES_API_TOKEN", "secret")
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if r.URL.Path == "/quote" {
+			w.Header().Set("Cache-Control", "no-store")
+			_, _ = w.Write([]byte(`{"quote":1}`))
+			return
+		}
+		requests++
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"eur-1"` {
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"eur-1"`)
+		w.Header().Set("Cache-Control", "max-age=0")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"currency":"` + r.URL.Path[len("/rates/"):] + `"}`))
+	}))
+	defer server.Close()
+
+	source := &httpSource{configs: make(map[string]HttpConfiguration), cache: newCacheStore(), client: server.Client()}
+	config := `
+- name: rates
+  url: ` + server.URL + `/rates/{currency}
+  headers:
+    Authorization: Bearer ${RATES_API_TOKEN}
+- name: broken
+  url: ` + server.URL + `/broken
+- name: quote
+  url: ` + server.URL + `/quote
+`
+	if err := source.Init(func(v interface{}) error { return yaml.Unmarshal([]byte(config), v) }); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	request := CacheRequest{Name: "rates", Params: map[string]string{"currency": "EUR"}}
+	result, err := source.Fetch(request)
+	if err != nil || result.Data != `{"currency":"EUR"}` || result.ContentType != "application/json" {
+		t.Fatalf("Expected upstream response. Got %+v", result)
+	}
+
+	// max-age=0 makes the next lookup revalidate, the 304 response extends the copy by max-age
+	result, _ = source.Fetch(request)
+	cached, _ := source.cache.Get("rates?currency=EUR")
+	if result.Data != `{"currency":"EUR"}` || requests != 2 || time.Until(cached.CacheExpiry) < 30*time.Second {
+		t.Errorf("Expected revalidated copy. Got %+v after %d requests", result, requests)
+	}
+
+	if _, err := source.Fetch(CacheRequest{Name: "rates"}); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("Expected lookup without path parameter to be invalid. Got %v", err)
+	}
+	if _, err := source.Fetch(CacheRequest{Name: "broken"}); !errors.Is(err, ErrOriginUnavailable) {
+		t.Errorf("Expected failing upstream to be unavailable. Got %v", err)
+	}
+	if stats := source.Stats()["broken"]; stats.OriginErrors != 1 {
+		t.Errorf("Expected origin error to be counted. Got %+v", stats)
+	}
+
+	if result, err := source.Fetch(CacheRequest{Name: "quote"}); err != nil || result.Data != `{"quote":1}` {
+		t.Errorf("Expected no-store response to be served. Got %+v, %v", result, err)
+	}
+	if _, ok := source.Peek("quote"); ok {
+		t.Error("Expected no-store response not to be cached")
+	}
+
+	// Invalidating the upstream drops the responses of every path parameter
+	source.Fetch(CacheRequest{Name: "rates", Params: map[string]string{"currency": "USD"}})
+	source.Invalidate("rates")
+	if keys := source.Keys("rates"); len(keys) != 0 {
+		t.Errorf("Expected every response of the upstream to be invalidated. Got %v", keys)
+	}
+}
+
+func TestHttpUpstreamErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/expired":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/forbidden":
+			w.WriteHeader(http.StatusForbidden)
+		case "/large":
+			_, _ = w.Write(make([]byte, maxHttpResponseSize+1))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	source := &httpSource{configs: make(map[string]HttpConfiguration), cache: newCacheStore(), client: server.Client()}
+	config := "- name: expired\n  url: " + server.URL + "/expired\n" +
+		"- name: forbidden\n  url: " + server.URL + "/forbidden\n" +
+		"- name: large\n  url: " + server.URL + "/large\n" +
+		"- name: missing\n  url: " + server.URL + "/missing\n"
+	if err := source.Init(func(v interface{}) error { return yaml.Unmarshal([]byte(config), v) }); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// Rejected credentials are reported as a failing upstream instead of a missing response
+	for _, name := range []string{"expired", "forbidden"} {
+		if _, err := source.Fetch(CacheRequest{Name: name}); !errors.Is(err, ErrOriginUnavailable) {
+			t.Errorf("%s: expected the upstream to be unavailable. Got %v", name, err)
+		}
+	}
+	if _, err := source.Fetch(CacheRequest{Name: "large"}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected the response to be too large. Got %v", err)
+	}
+	if _, err := source.Fetch(CacheRequest{Name: "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the response not to be found. Got %v", err)
+	}
+}
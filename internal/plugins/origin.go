@@ -0,0 +1,260 @@
+package plugins
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// Lambda environment variables for tuning calls to the origin services
+const (
+	OriginTimeOut           = "CACHE_EXTENSION_ORIGIN_TIMEOUT"
+	OriginMaxRetries        = "CACHE_EXTENSION_ORIGIN_MAX_RETRIES"
+	CircuitBreakerThreshold = "CACHE_EXTENSION_CIRCUIT_BREAKER_THRESHOLD"
+	CircuitBreakerCooldown  = "CACHE_EXTENSION_CIRCUIT_BREAKER_COOLDOWN"
+)
+
+// Time kept free before the invoke deadline so the function can still handle a failed lookup
+const deadlineMargin = 50 * time.Millisecond
+
+// Returned when the circuit breaker of an origin is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Deadline of the current invoke in unix milliseconds, zero if unknown
+var invokeDeadlineMs int64
+
+// Record the deadline of the current invoke received from the Extensions API
+func SetInvokeDeadline(deadlineMs int64) {
+	atomic.StoreInt64(&invokeDeadlineMs, deadlineMs)
+}
+
+// Return a context bound to the origin timeout, shortened to the invoke deadline when it is closer
+func OriginContext() (context.Context, context.CancelFunc) {
+	timeout := getDurationEnv(OriginTimeOut, 3*time.Second)
+
+	deadlineMs := atomic.LoadInt64(&invokeDeadlineMs)
+	if deadlineMs > 0 {
+		remaining := time.Until(time.UnixMilli(deadlineMs)) - deadlineMargin
+		// A deadline in the past belongs to a finished invoke
+		if remaining > 0 && remaining < timeout {
+			timeout = remaining
+		}
+	}
+
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// Return AWS client configuration with jittered exponential backoff for throttling errors
+func OriginConfig() *aws.Config {
+	retryer := client.DefaultRetryer{
+		NumMaxRetries:    getIntEnv(OriginMaxRetries, client.DefaultRetryerMaxNumRetries),
+		MinRetryDelay:    client.DefaultRetryerMinRetryDelay,
+		MaxRetryDelay:    client.DefaultRetryerMaxRetryDelay,
+		MinThrottleDelay: 50 * time.Millisecond,
+		MaxThrottleDelay: time.Second,
+	}
+	return request.WithRetryer(aws.NewConfig(), retryer)
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// Per-origin circuit breaker which opens after consecutive failures and lets a single probe
+// through once the cooldown has passed
+type circuitBreaker struct {
+	mu        sync.Mutex
+	name      string
+	state     circuitState
+	failures  int
+	openedAt  time.Time
+	threshold int
+	cooldown  time.Duration
+}
+
+var (
+	circuitBreakers   = make(map[string]*circuitBreaker)
+	circuitBreakersMu sync.Mutex
+)
+
+// Get the circuit breaker of an origin, created on first use
+func GetCircuitBreaker(name string) *circuitBreaker {
+	circuitBreakersMu.Lock()
+	defer circuitBreakersMu.Unlock()
+
+	breaker, ok := circuitBreakers[name]
+	if !ok {
+		breaker = &circuitBreaker{
+			name:      name,
+			threshold: getIntEnv(CircuitBreakerThreshold, 5),
+			cooldown:  getDurationEnv(CircuitBreakerCooldown, 30*time.Second),
+		}
+		circuitBreakers[name] = breaker
+	}
+	return breaker
+}
+
+// Check whether a call to the origin is allowed
+func (b *circuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		// Only the probe is allowed until it reports back
+		return false
+	default:
+		return true
+	}
+}
+
+// Check whether the origin is currently considered unhealthy
+func (b *circuitBreaker) IsOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state != circuitClosed
+}
+
+// Report a successful call to the origin
+func (b *circuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != circuitClosed {
+		println(PrintPrefix, fmt.Sprintf("Circuit breaker of %s closed", b.name))
+	}
+	b.state = circuitClosed
+	b.failures = 0
+}
+
+// Report a failed call to the origin
+func (b *circuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		if b.state != circuitOpen {
+			println(PrintPrefix, fmt.Sprintf("Circuit breaker of %s opened after %d failures", b.name, b.failures))
+		}
+		b.state = circuitOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// Run a call to the origin guarded by its circuit breaker
+func (b *circuitBreaker) Call(call func() error) error {
+	if !b.Allow() {
+		return fmt.Errorf("%s: %w", b.name, ErrCircuitOpen)
+	}
+
+	err := call()
+	if isOriginFailure(err) {
+		b.Failure()
+	} else {
+		b.Success()
+	}
+	return err
+}
+
+// Check whether an error means the origin is unhealthy, as opposed to a rejected request. Only
+// timeouts, network errors, throttling and server faults count
+func isOriginFailure(err error) bool {
+	if err == nil || errors.Is(err, ErrTooLarge) {
+		return false
+	}
+	if errors.Is(err, ErrOriginUnavailable) || errors.Is(err, ErrOriginTimeout) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	if request.IsErrorThrottle(err) {
+		return true
+	}
+
+	var requestFailure awserr.RequestFailure
+	if errors.As(err, &requestFailure) && requestFailure.StatusCode() >= 500 {
+		return true
+	}
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		switch awsErr.Code() {
+		// The SDK reports an expired context as a canceled request
+		case request.CanceledErrorCode, request.ErrCodeRequestError, request.ErrCodeRead, request.ErrCodeResponseTimeout:
+			return true
+		}
+	}
+	return false
+}
+
+// Check whether a stale copy may be served for an error, only when the origin is unhealthy
+func isStaleServable(err error) bool {
+	return errors.Is(err, ErrCircuitOpen) || isOriginFailure(err)
+}
+
+// Read a duration from an environment variable, falling back to a default when not set
+func getDurationEnv(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		panic("Error while converting " + name + " env variable " + value)
+	}
+	return duration
+}
+
+// Read an integer from an environment variable, falling back to a default when not set
+func getIntEnv(name string, defaultValue int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		panic("Error while converting " + name + " env variable " + value)
+	}
+	return number
+}
+
+// Read a boolean from an environment variable, falling back to a default when not set
+func getBoolEnv(name string, defaultValue bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		panic("Error while converting " + name + " env variable " + value)
+	}
+	return enabled
+}
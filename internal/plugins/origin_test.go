@@ -0,0 +1,80 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	breaker := &circuitBreaker{name: "test", threshold: 2, cooldown: 20 * time.Millisecond}
+	unavailable := awserr.NewRequestFailure(awserr.New("InternalServerError", "unavailable", nil), 500, "")
+
+	for i := 0; i < 2; i++ {
+		_ = breaker.Call(func() error { return unavailable })
+	}
+	if !breaker.IsOpen() {
+		t.Fatal("Expected circuit breaker to open after consecutive failures")
+	}
+
+	called := false
+	err := breaker.Call(func() error { called = true; return nil })
+	if called || !errors.Is(err, ErrCircuitOpen) {
+		t.Error("Expected open circuit breaker to fail fast")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if err := breaker.Call(func() error { return nil }); err != nil {
+		t.Errorf("Expected probe to be allowed after cooldown. Got %s", err)
+	}
+	if breaker.IsOpen() {
+		t.Error("Expected circuit breaker to close after a successful probe")
+	}
+
+	notFound := awserr.NewRequestFailure(awserr.New("ValidationException", "bad key", nil), 400, "")
+	for i := 0; i < 3; i++ {
+		_ = breaker.Call(func() error { return notFound })
+	}
+	if breaker.IsOpen() {
+		t.Error("Expected rejected requests not to open the circuit breaker")
+	}
+
+	invalid := errors.New("sql: syntax error")
+	for i := 0; i < 3; i++ {
+		_ = breaker.Call(func() error { return invalid })
+	}
+	if breaker.IsOpen() {
+		t.Error("Expected errors which are not origin failures not to open the circuit breaker")
+	}
+}
+
+func TestIsOriginFailure(t *testing.T) {
+	tests := []struct {
+		err     error
+		failure bool
+	}{
+		{errors.New("invalid character in JSON"), false},
+		{fmt.Errorf("%w: missing parameter", ErrInvalidRequest), false},
+		{awserr.NewRequestFailure(awserr.New("ValidationException", "bad key", nil), 400, ""), false},
+		{awserr.NewRequestFailure(awserr.New("InternalServerError", "unavailable", nil), 503, ""), true},
+		{awserr.New("ThrottlingException", "slow down", nil), true},
+		{awserr.New(request.ErrCodeRequestError, "send request failed", nil), true},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), true},
+		{fmt.Errorf("%w: upstream responded with 502", ErrOriginUnavailable), true},
+	}
+	for _, test := range tests {
+		if failure := isOriginFailure(test.err); failure != test.failure {
+			t.Errorf("%v: expected origin failure %t", test.err, test.failure)
+		}
+	}
+	if isStaleServable(errors.New("invalid")) || !isStaleServable(ErrCircuitOpen) {
+		t.Error("Expected stale copies to be served for unhealthy origins only")
+	}
+}
@@ -0,0 +1,89 @@
+package pluginstest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/plugins"
+)
+
+// Entry of the section of cache.yaml passed to a fake source
+type Configuration struct {
+	Name string `yaml:"name"`
+}
+
+// Source answering lookups from a fixed set of results and errors, without query support
+type Source struct {
+	Results map[string]plugins.CacheResult
+	Errors  map[string]error
+	// Returned by Stats
+	Counters map[string]plugins.CacheStats
+
+	// Section of cache.yaml passed to Init
+	Configs   []Configuration
+	Preloaded bool
+	// Last request passed to Fetch
+	Last        plugins.CacheRequest
+	Invalidated []string
+}
+
+func (s *Source) Init(unmarshal func(interface{}) error) error {
+	return unmarshal(&s.Configs)
+}
+
+func (s *Source) Preload() error {
+	s.Preloaded = true
+	return nil
+}
+
+func (s *Source) Fetch(request plugins.CacheRequest) (plugins.CacheResult, error) {
+	s.Last = request
+	if err, ok := s.Errors[request.Name]; ok {
+		return plugins.CacheResult{}, err
+	}
+	if result, ok := s.Results[request.Name]; ok {
+		return result, nil
+	}
+	return plugins.CacheResult{}, fmt.Errorf("%w: %s", plugins.ErrNotFound, request.Name)
+}
+
+func (s *Source) Invalidate(name string) {
+	s.Invalidated = append(s.Invalidated, name)
+}
+
+func (s *Source) Stats() map[string]plugins.CacheStats {
+	return s.Counters
+}
+
+// Source which also queries and lists its results
+type QuerySource struct {
+	Source
+}
+
+// Return the results whose name starts with the name of the request
+func (s *QuerySource) Query(request plugins.CacheRequest) ([]plugins.CacheResult, error) {
+	var results []plugins.CacheResult
+	for name, result := range s.Results {
+		if strings.HasPrefix(name, request.Name) {
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+func (s *QuerySource) Keys(prefix string) []string {
+	var keys []string
+	for name := range s.Results {
+		if strings.HasPrefix(name, prefix) {
+			keys = append(keys, name)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *QuerySource) Peek(name string) (plugins.CacheData, bool) {
+	result, ok := s.Results[name]
+	return plugins.CacheData{Data: result.Data, CacheExpiry: result.CacheExpiry}, ok
+}
@@ -0,0 +1,155 @@
+package plugins
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Lambda environment variables configuring Redis or ElastiCache as a shared second-tier cache.
+// The tier is disabled unless an address is set
+const (
+	RedisAddress   = "CACHE_EXTENSION_REDIS_ADDRESS"
+	RedisCluster   = "CACHE_EXTENSION_REDIS_CLUSTER"
+	RedisTls       = "CACHE_EXTENSION_REDIS_TLS"
+	RedisUsername  = "CACHE_EXTENSION_REDIS_USERNAME"
+	RedisPassword  = "CACHE_EXTENSION_REDIS_PASSWORD"
+	RedisTimeOut   = "CACHE_EXTENSION_REDIS_TIMEOUT"
+	RedisKeyPrefix = "CACHE_EXTENSION_REDIS_KEY_PREFIX"
+)
+
+// Entry of the shared cache, the expiry is kept so every execution environment expires it at the same time
+type sharedCacheEntry struct {
+	Data        string    `json:"data"`
+	CacheExpiry time.Time `json:"cacheExpiry"`
+	FetchedAt   time.Time `json:"fetchedAt"`
+	HardExpiry  time.Time `json:"hardExpiry,omitempty"`
+}
+
+var (
+	redisClient  redis.UniversalClient
+	redisTimeout time.Duration
+	redisPrefix  string
+	redisOnce    sync.Once
+)
+
+// Get the client of the shared cache, nil if it is not configured
+func getRedisClient() redis.UniversalClient {
+	redisOnce.Do(func() {
+		address := os.Getenv(RedisAddress)
+		if address == "" {
+			return
+		}
+
+		redisTimeout = getDurationEnv(RedisTimeOut, 50*time.Millisecond)
+		redisPrefix = os.Getenv(RedisKeyPrefix)
+		if redisPrefix == "" {
+			redisPrefix = "dynamodb-cache:"
+		}
+
+		options := &redis.UniversalOptions{
+			Addrs:    strings.Split(address, ","),
+			Username: os.Getenv(RedisUsername),
+			Password: os.Getenv(RedisPassword),
+			// A slow shared cache falls through to the origin instead of being retried
+			MaxRetries:   -1,
+			DialTimeout:  redisTimeout,
+			ReadTimeout:  redisTimeout,
+			WriteTimeout: redisTimeout,
+		}
+		if getBoolEnv(RedisTls, false) {
+			options.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+
+		// A cluster mode enabled ElastiCache has a single configuration endpoint
+		if getBoolEnv(RedisCluster, false) {
+			redisClient = redis.NewClusterClient(options.Cluster())
+		} else {
+			redisClient = redis.NewUniversalClient(options)
+		}
+		println(PrintPrefix, "Using shared cache at "+address)
+	})
+	return redisClient
+}
+
+// Read an entry from the shared cache. Errors and timeouts are reported as a miss so the
+// lookup falls through to the origin
+func getSharedCache(key string) (CacheData, bool) {
+	client := getRedisClient()
+	if client == nil {
+		return CacheData{}, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	value, err := client.Get(ctx, redisPrefix+key).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			println(PrintPrefix, fmt.Sprintf("Error reading '%s' from shared cache: %s", key, err))
+		}
+		return CacheData{}, false
+	}
+
+	var entry sharedCacheEntry
+	if err := json.Unmarshal(value, &entry); err != nil {
+		println(PrintPrefix, fmt.Sprintf("Invalid entry '%s' in shared cache: %s", key, err))
+		return CacheData{}, false
+	}
+	if IsExpired(entry.CacheExpiry) {
+		return CacheData{}, false
+	}
+	return CacheData{
+		Data:        entry.Data,
+		CacheExpiry: entry.CacheExpiry,
+		FetchedAt:   entry.FetchedAt,
+		HardExpiry:  entry.HardExpiry,
+	}, true
+}
+
+// Write an entry to the shared cache, it expires with the entry's cache expiry
+func setSharedCache(key string, data CacheData) {
+	client := getRedisClient()
+	ttl := time.Until(data.CacheExpiry)
+	if client == nil || ttl <= 0 {
+		return
+	}
+
+	value, err := json.Marshal(sharedCacheEntry{
+		Data:        data.Data,
+		CacheExpiry: data.CacheExpiry,
+		FetchedAt:   data.FetchedAt,
+		HardExpiry:  data.HardExpiry,
+	})
+	if err != nil {
+		println(PrintPrefix, fmt.Sprintf("Could not encode '%s' for shared cache: %s", key, err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := client.Set(ctx, redisPrefix+key, value, ttl).Err(); err != nil {
+		println(PrintPrefix, fmt.Sprintf("Error writing '%s' to shared cache: %s", key, err))
+	}
+}
+
+// Remove an entry from the shared cache
+func deleteSharedCache(key string) {
+	client := getRedisClient()
+	if client == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := client.Del(ctx, redisPrefix+key).Err(); err != nil {
+		println(PrintPrefix, fmt.Sprintf("Error removing '%s' from shared cache: %s", key, err))
+	}
+}
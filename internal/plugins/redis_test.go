@@ -0,0 +1,113 @@
+package plugins
+
+import (
+	"context"
+	"net"
+	"os/exec"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/redis/go-redis/v9"
+)
+
+// Start a redis-server on a free port and point the shared cache at it
+func startRedisServer(t *testing.T) {
+	path, err := exec.LookPath("redis-server")
+	if err != nil {
+		t.Skip("redis-server is not installed")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	server := exec.Command(path, "--port", strconv.Itoa(port), "--save", "", "--appendonly", "no")
+	if err := server.Start(); err != nil {
+		t.Fatalf("Could not start redis-server: %s", err)
+	}
+	t.Cleanup(func() {
+		_ = server.Process.Kill()
+		_ = server.Wait()
+	})
+
+	address := "127.0.0.1:" + strconv.Itoa(port)
+	client := redis.NewClient(&redis.Options{Addr: address})
+	defer client.Close()
+	for i := 0; client.Ping(context.Background()).Err() != nil; i++ {
+		if i == 50 {
+			t.Fatalf("redis-server did not start on %s", address)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	t.Setenv(RedisAddress, address)
+	t.Setenv(RedisTimeOut, "500ms")
+	redisClient, redisOnce = nil, sync.Once{}
+	t.Cleanup(func() {
+		if redisClient != nil {
+			redisClient.Close()
+		}
+		redisClient, redisOnce = nil, sync.Once{}
+	})
+}
+
+func TestSharedCache(t *testing.T) {
+	startRedisServer(t)
+	resetDynamoDbCache(t)
+
+	client := &fakeDynamoDbClient{items: map[string]map[string]*dynamodb.AttributeValue{
+		"a": {"pk": {S: aws.String("a")}, "sk": {N: aws.String("1")}, "value": {S: aws.String("origin")}},
+	}}
+	defer dynamoDbClients.delete("shared")
+	dynamoDbClients.set("shared", client)
+	previous := initializedConfig
+	t.Cleanup(func() { initializedConfig = previous })
+	initializedConfig = map[string]DynamoDbConfiguration{
+		"shared": {Table: "shared", HashKey: "pk", HashKeyType: "S", SortKey: "sk", SortKeyType: "N"},
+	}
+
+	// An item loaded by another execution environment is served without calling Dynamodb
+	setSharedCache("shared@@b@@1", CacheData{Data: `{"value":"shared"}`, CacheExpiry: time.Now().Add(time.Minute)})
+	if result, _ := FetchDynamoDbCache("shared@@b@@1"); result.Data != `{"value":"shared"}` || result.Tier != TierShared || client.getItems != 0 {
+		t.Fatalf("Expected item of the shared cache. Got %+v after %d calls", result, client.getItems)
+	}
+	if cached, _ := getDynamoDbCache("shared@@b@@1"); cached.Data.Data != `{"value":"shared"}` {
+		t.Errorf("Expected shared item in memory. Got %+v", cached)
+	}
+
+	// Items read from Dynamodb are written back to the shared cache
+	if result, _ := FetchDynamoDbCache("shared@@a@@1"); result.Data != `{"pk":"a","sk":1,"value":"origin"}` || result.Status != CacheMiss || client.getItems != 1 {
+		t.Fatalf("Expected item of Dynamodb. Got %+v after %d calls", result, client.getItems)
+	}
+	data, ok := getSharedCache("shared@@a@@1")
+	if !ok || data.Data != `{"pk":"a","sk":1,"value":"origin"}` {
+		t.Errorf("Expected item in the shared cache. Got %+v", data)
+	}
+	if ttl := redisClient.TTL(context.Background(), "dynamodb-cache:shared@@a@@1").Val(); ttl <= 0 {
+		t.Errorf("Expected shared item to expire. Got TTL %s", ttl)
+	}
+
+	(&dynamoDbSource{}).Invalidate("shared@@a@@1")
+	if _, ok := getSharedCache("shared@@a@@1"); ok {
+		t.Error("Expected invalidated item to be removed from the shared cache")
+	}
+}
+
+func TestSharedCacheUnavailable(t *testing.T) {
+	// Nothing listens on the address, lookups fall through to the origin
+	t.Setenv(RedisAddress, "127.0.0.1:1")
+	redisClient, redisOnce = nil, sync.Once{}
+	defer func() { redisClient, redisOnce = nil, sync.Once{} }()
+
+	setSharedCache("key", CacheData{Data: "value", CacheExpiry: time.Now().Add(time.Minute)})
+	if _, ok := getSharedCache("key"); ok {
+		t.Error("Expected unavailable shared cache to report a miss")
+	}
+}
@@ -0,0 +1,280 @@
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// Cache type of S3
+const S3 = "s3"
+
+// Objects larger than this are not cached unless configured otherwise
+const defaultMaxObjectSize = 5 * 1024 * 1024
+
+// Struct to store S3 cache configuration. Either a single object is configured by key or all
+// objects below a prefix
+type S3Configuration struct {
+	Bucket  string `yaml:"bucket"`
+	Key     string `yaml:"key"`
+	Prefix  string `yaml:"prefix"`
+	MaxSize int64  `yaml:"maxSize"`
+	Ttl     string `yaml:"ttl"`
+
+	// Region, endpoint and credentials used for this bucket
+	AwsConfiguration `yaml:",inline"`
+
+	ttl time.Duration
+}
+
+// Source serving objects of S3
+type s3Source struct {
+	configs []S3Configuration
+	cache   *cacheStore
+}
+
+var (
+	// Custom endpoints such as MinIO or LocalStack usually need path style addressing
+	s3Clients = newClientCache[AwsConfiguration](func(sess *session.Session, config AwsConfiguration) s3iface.S3API {
+		return s3.New(sess, aws.NewConfig().WithS3ForcePathStyle(config.Endpoint != ""))
+	})
+)
+
+func init() {
+	RegisterSource(S3, &s3Source{cache: newCacheStore()})
+}
+
+// Initialize the objects listed in the s3 section of cache.yaml
+func (s *s3Source) Init(unmarshal func(interface{}) error) error {
+	var configs []S3Configuration
+	if err := unmarshal(&configs); err != nil {
+		return err
+	}
+
+	for i := range configs {
+		config := &configs[i]
+		if config.Bucket == "" {
+			return fmt.Errorf("bucket is required for s3 objects")
+		}
+		if config.Key != "" && config.Prefix != "" {
+			return fmt.Errorf("only one of key and prefix can be set for s3 bucket %s", config.Bucket)
+		}
+		if config.MaxSize <= 0 {
+			config.MaxSize = defaultMaxObjectSize
+		}
+
+		ttl, err := ParseTtl(config.Ttl)
+		if err != nil {
+			return fmt.Errorf("s3 bucket %s: %w", config.Bucket, err)
+		}
+		config.ttl = ttl
+	}
+
+	s.configs = configs
+	return nil
+}
+
+// Load every configured object and every object below the configured prefixes
+func (s *s3Source) Preload() error {
+	var failed []string
+	for _, config := range s.configs {
+		if config.Key != "" {
+			if _, err := s.Fetch(CacheRequest{Name: config.Bucket + "/" + config.Key}); err != nil {
+				failed = append(failed, config.Bucket+"/"+config.Key)
+			}
+			continue
+		}
+
+		if err := s.loadPrefix(config); err != nil {
+			println(PrintPrefix, fmt.Sprintf("Error loading s3 objects %s/%s: %s", config.Bucket, config.Prefix, err))
+			failed = append(failed, config.Bucket+"/"+config.Prefix)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not load s3 objects %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Fetch an object by "bucket/key" with its original content type
+func (s *s3Source) Fetch(request CacheRequest) (CacheResult, error) {
+	bucket, key, _ := strings.Cut(request.Name, "/")
+	config, ok := s.configFor(bucket, key)
+	if !ok {
+		return CacheResult{}, fmt.Errorf("%w: no s3 configuration for object '%s'", ErrNotFound, request.Name)
+	}
+
+	return s.cache.Fetch(request.Name, config.Bucket+"/"+config.Key+config.Prefix, S3+":"+config.Bucket, request.NoCache, func(cached CacheData) (CacheData, bool, error) {
+		return s.getObject(config, key, cached)
+	})
+}
+
+func (s *s3Source) Invalidate(name string) {
+	s.cache.Delete(name)
+}
+
+func (s *s3Source) Keys(prefix string) []string {
+	return s.cache.KeysWithPrefix(prefix)
+}
+
+func (s *s3Source) Peek(name string) (CacheData, bool) {
+	return s.cache.Get(name)
+}
+
+func (s *s3Source) Stats() map[string]CacheStats {
+	return s.cache.StatsSnapshot()
+}
+
+// Find the configuration of an object, an exact key wins over the longest matching prefix
+func (s *s3Source) configFor(bucket string, key string) (S3Configuration, bool) {
+	var match S3Configuration
+	found := false
+	for _, config := range s.configs {
+		if config.Bucket != bucket || key == "" {
+			continue
+		}
+		if config.Key == key {
+			return config, true
+		}
+		if config.Key == "" && strings.HasPrefix(key, config.Prefix) && (!found || len(config.Prefix) > len(match.Prefix)) {
+			match = config
+			found = true
+		}
+	}
+	return match, found
+}
+
+// Read an object from S3. When an expired copy is cached the object is only downloaded if its
+// ETag changed, otherwise the copy is kept for another TTL
+func (s *s3Source) getObject(config S3Configuration, key string, cached CacheData) (CacheData, bool, error) {
+	client, err := GetS3Client(config.AwsConfiguration)
+	if err != nil {
+		return CacheData{}, false, err
+	}
+
+	input := &s3.GetObjectInput{Bucket: aws.String(config.Bucket), Key: aws.String(key)}
+	if cached.Data != "" && cached.OriginETag != "" {
+		input.IfNoneMatch = aws.String(cached.OriginETag)
+	}
+
+	ctx, cancel := OriginContext()
+	defer cancel()
+	result, err := client.GetObjectWithContext(ctx, input)
+	if err != nil {
+		var requestFailure awserr.RequestFailure
+		if errors.As(err, &requestFailure) {
+			switch requestFailure.StatusCode() {
+			case http.StatusNotModified:
+				cached.CacheExpiry = GetCacheExpiryFor(config.ttl)
+				cached.FetchedAt = time.Now()
+				return cached, true, nil
+			case http.StatusNotFound:
+				println(PrintPrefix, "Could not find s3 object '"+config.Bucket+"/"+key+"'")
+				return CacheData{}, false, nil
+			}
+		}
+		return CacheData{}, false, err
+	}
+	defer result.Body.Close()
+
+	// The length is not known in advance for every object, so the body is limited as well
+	if aws.Int64Value(result.ContentLength) > config.MaxSize {
+		return CacheData{}, false, objectTooLarge(config, key)
+	}
+	body, err := io.ReadAll(io.LimitReader(result.Body, config.MaxSize+1))
+	if err != nil {
+		return CacheData{}, false, err
+	}
+	if int64(len(body)) > config.MaxSize {
+		return CacheData{}, false, objectTooLarge(config, key)
+	}
+
+	return CacheData{
+		Data:        string(body),
+		CacheExpiry: GetCacheExpiryFor(config.ttl),
+		FetchedAt:   time.Now(),
+		ContentType: aws.StringValue(result.ContentType),
+		OriginETag:  aws.StringValue(result.ETag),
+	}, true, nil
+}
+
+// Error of an object which is larger than the size limit and will not be cached
+func objectTooLarge(config S3Configuration, key string) error {
+	println(PrintPrefix, fmt.Sprintf("S3 object '%s/%s' is larger than %d bytes and will not be cached", config.Bucket, key, config.MaxSize))
+	return fmt.Errorf("%w: s3 object '%s/%s' exceeds %d bytes", ErrTooLarge, config.Bucket, key, config.MaxSize)
+}
+
+// Read all objects below a prefix which fit the size limit and add them to the cache
+func (s *s3Source) loadPrefix(config S3Configuration) error {
+	client, err := GetS3Client(config.AwsConfiguration)
+	if err != nil {
+		return err
+	}
+
+	// Every page is bound by the origin timeout and recorded by the circuit breaker of the bucket
+	breaker := GetCircuitBreaker(S3 + ":" + config.Bucket)
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(config.Bucket),
+		Prefix: aws.String(config.Prefix),
+	}
+	var keys []string
+	for {
+		var page *s3.ListObjectsV2Output
+		err := breaker.Call(func() error {
+			ctx, cancel := OriginContext()
+			defer cancel()
+			var err error
+			page, err = client.ListObjectsV2WithContext(ctx, input)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		for _, object := range page.Contents {
+			key := aws.StringValue(object.Key)
+			if strings.HasSuffix(key, "/") || aws.Int64Value(object.Size) > config.MaxSize {
+				continue
+			}
+			keys = append(keys, key)
+		}
+		if !aws.BoolValue(page.IsTruncated) || aws.StringValue(page.NextContinuationToken) == "" {
+			break
+		}
+		input.ContinuationToken = page.NextContinuationToken
+	}
+
+	for _, key := range keys {
+		var data CacheData
+		var found bool
+		err := breaker.Call(func() error {
+			var err error
+			data, found, err = s.getObject(config, key, CacheData{})
+			return err
+		})
+		if errors.Is(err, ErrTooLarge) {
+			// The object grew after it was listed
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if found {
+			s.cache.Set(config.Bucket+"/"+key, data)
+		}
+	}
+	return nil
+}
+
+// Get the S3 client for a region, endpoint and role, created on first use
+func GetS3Client(config AwsConfiguration) (s3iface.S3API, error) {
+	return s3Clients.get(config, config)
+}
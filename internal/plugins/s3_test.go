@@ -0,0 +1,141 @@
+package plugins
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestS3ConditionalRefresh(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+	// The default session resolves credentials when it is created
+	defaultSession, defaultSessionErr = nil, nil
+	defer func() { defaultSession, defaultSessionErr = nil, nil }()
+
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rules/rules.json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"rules":[]}`))
+	}))
+	defer server.Close()
+
+	source := &s3Source{cache: newCacheStore()}
+	config := "- bucket: rules\n  key: rules.json\n  region: us-east-1\n  endpoint: " + server.URL + "\n"
+	if err := source.Init(func(v interface{}) error { return yaml.Unmarshal([]byte(config), v) }); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer s3Clients.delete(source.configs[0].AwsConfiguration)
+
+	result, err := source.Fetch(CacheRequest{Name: "rules/rules.json"})
+	if err != nil || result.Data != `{"rules":[]}` || result.ContentType != "application/json" {
+		t.Fatalf("Expected object with its content type. Got %+v", result)
+	}
+
+	// Expire the entry, the refresh is answered with 304 and keeps the cached copy
+	cached, _ := source.cache.Get("rules/rules.json")
+	cached.CacheExpiry = time.Now().Add(-time.Second)
+	source.cache.Set("rules/rules.json", cached)
+
+	result, _ = source.Fetch(CacheRequest{Name: "rules/rules.json"})
+	if result.Data != `{"rules":[]}` || downloads != 1 {
+		t.Errorf("Expected unchanged object not to be downloaded again. Got %+v after %d downloads", result, downloads)
+	}
+	if cached, _ := source.cache.Get("rules/rules.json"); IsExpired(cached.CacheExpiry) {
+		t.Error("Expected refreshed entry to get a new expiry")
+	}
+
+	if _, err := source.Fetch(CacheRequest{Name: "rules/other.json"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected unconfigured object not to be found. Got %v", err)
+	}
+}
+
+func TestS3ObjectTooLarge(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv(CircuitBreakerThreshold, "1")
+	defaultSession, defaultSessionErr = nil, nil
+	defer func() { defaultSession, defaultSessionErr = nil, nil }()
+	defer delete(circuitBreakers, S3+":large")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/large/streamed.bin" {
+			// Flushing before the body is complete leaves the length unknown
+			w.(http.Flusher).Flush()
+		}
+		_, _ = w.Write([]byte("0123456789"))
+	}))
+	defer server.Close()
+
+	source := &s3Source{cache: newCacheStore()}
+	config := "- bucket: large\n  prefix: \"\"\n  maxSize: 4\n  region: us-east-1\n  endpoint: " + server.URL + "\n"
+	if err := source.Init(func(v interface{}) error { return yaml.Unmarshal([]byte(config), v) }); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer s3Clients.delete(source.configs[0].AwsConfiguration)
+
+	// Objects are rejected the same way whether their length is announced or not
+	for _, name := range []string{"large/sized.bin", "large/streamed.bin"} {
+		if _, err := source.Fetch(CacheRequest{Name: name}); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("%s: expected the object to be rejected as too large. Got %v", name, err)
+		}
+	}
+	if GetCircuitBreaker(S3 + ":large").IsOpen() {
+		t.Error("Expected objects which are too large not to open the circuit breaker")
+	}
+}
+
+func TestS3PreloadPrefixTimeout(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv(OriginTimeOut, "50ms")
+	t.Setenv(OriginMaxRetries, "0")
+	t.Setenv(CircuitBreakerThreshold, "1")
+	defaultSession, defaultSessionErr = nil, nil
+	defer func() { defaultSession, defaultSessionErr = nil, nil }()
+	defer delete(circuitBreakers, S3+":hanging")
+
+	// Listing the bucket never answers
+	stop := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-stop:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(stop)
+
+	source := &s3Source{cache: newCacheStore()}
+	config := "- bucket: hanging\n  prefix: config/\n  region: us-east-1\n  endpoint: " + server.URL + "\n"
+	if err := source.Init(func(v interface{}) error { return yaml.Unmarshal([]byte(config), v) }); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer s3Clients.delete(source.configs[0].AwsConfiguration)
+
+	start := time.Now()
+	if err := source.Preload(); err == nil {
+		t.Fatal("Expected the preload to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected listing the bucket to be bound by the origin timeout. Took %s", elapsed)
+	}
+	if !GetCircuitBreaker(S3 + ":hanging").IsOpen() {
+		t.Error("Expected the failed listing to open the circuit breaker of the bucket")
+	}
+}
@@ -0,0 +1,310 @@
+package plugins
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+)
+
+// Cache type of Secrets Manager
+const SecretsManager = "secretsmanager"
+
+// Query parameter selecting a single key of a JSON secret
+const SecretKeyParam = "key"
+
+// Struct to store Secrets Manager cache configuration. A secret is read by version stage
+// (AWSCURRENT by default) or pinned to a version ID
+type SecretsManagerConfiguration struct {
+	SecretId              string `yaml:"secretId"`
+	VersionStage          string `yaml:"versionStage"`
+	VersionId             string `yaml:"versionId"`
+	Ttl                   string `yaml:"ttl"`
+	RotationCheckInterval string `yaml:"rotationCheckInterval"`
+
+	// Region, endpoint and credentials used for this secret
+	AwsConfiguration `yaml:",inline"`
+
+	ttl time.Duration
+}
+
+// Source serving secrets of Secrets Manager
+type secretsManagerSource struct {
+	configs map[string]SecretsManagerConfiguration
+	cache   *cacheStore
+	// Version ID of each cached secret, used to detect rotations
+	versions   map[string]string
+	versionsMu sync.Mutex
+	// Closed to stop the rotation watchers started by the last Init
+	stopWatchers chan struct{}
+}
+
+var (
+	secretsManagerClients = newClientCache[AwsConfiguration](func(sess *session.Session, _ AwsConfiguration) secretsmanageriface.SecretsManagerAPI {
+		return secretsmanager.New(sess)
+	})
+)
+
+func init() {
+	RegisterSource(SecretsManager, newSecretsManagerSource())
+}
+
+func newSecretsManagerSource() *secretsManagerSource {
+	return &secretsManagerSource{
+		configs:  make(map[string]SecretsManagerConfiguration),
+		cache:    newCacheStore(),
+		versions: make(map[string]string),
+	}
+}
+
+// Initialize the secrets listed in the secretsmanager section of cache.yaml and start watching
+// them for rotations. Watchers of a previous configuration are stopped
+func (s *secretsManagerSource) Init(unmarshal func(interface{}) error) error {
+	var configs []SecretsManagerConfiguration
+	if err := unmarshal(&configs); err != nil {
+		return err
+	}
+
+	if s.stopWatchers != nil {
+		close(s.stopWatchers)
+	}
+	s.stopWatchers = make(chan struct{})
+	s.configs = make(map[string]SecretsManagerConfiguration, len(configs))
+
+	for _, config := range configs {
+		if config.SecretId == "" {
+			return fmt.Errorf("secretId is required for secrets")
+		}
+		if config.VersionStage != "" && config.VersionId != "" {
+			return fmt.Errorf("only one of versionStage and versionId can be set for secret %s", config.SecretId)
+		}
+		if config.VersionStage == "" && config.VersionId == "" {
+			config.VersionStage = "AWSCURRENT"
+		}
+
+		ttl, err := ParseTtl(config.Ttl)
+		if err != nil {
+			return fmt.Errorf("secret %s: %w", config.SecretId, err)
+		}
+		config.ttl = ttl
+
+		interval, err := ParseTtl(config.RotationCheckInterval)
+		if err != nil {
+			return fmt.Errorf("secret %s: rotationCheckInterval: %w", config.SecretId, err)
+		}
+		if interval == 0 {
+			interval = 5 * time.Minute
+		}
+
+		s.configs[config.SecretId] = config
+
+		// A pinned version never changes
+		if config.VersionId == "" {
+			go s.watchRotation(config, interval, s.stopWatchers)
+		}
+	}
+	return nil
+}
+
+// Load every configured secret
+func (s *secretsManagerSource) Preload() error {
+	var failed []string
+	for secretId := range s.configs {
+		if _, err := s.Fetch(CacheRequest{Name: secretId}); err != nil {
+			failed = append(failed, secretId)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not load secrets %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Fetch a configured secret, or a single key of a JSON secret when the key parameter is set
+func (s *secretsManagerSource) Fetch(request CacheRequest) (CacheResult, error) {
+	config, ok := s.configs[request.Name]
+	if !ok {
+		return CacheResult{}, fmt.Errorf("%w: no secretsmanager configuration for secret '%s'", ErrNotFound, request.Name)
+	}
+
+	result, err := s.cache.Fetch(config.SecretId, config.SecretId, SecretsManager, request.NoCache, func(CacheData) (CacheData, bool, error) {
+		return s.getSecretValue(config)
+	})
+
+	key := request.Params[SecretKeyParam]
+	if key == "" || err != nil {
+		return result, err
+	}
+	value, err := secretKeyValue(result.Data, key)
+	if err != nil {
+		return CacheResult{}, fmt.Errorf("%w: could not read key '%s' of secret '%s': %s", ErrNotFound, key, config.SecretId, err)
+	}
+	result.Data = value
+	return result, nil
+}
+
+func (s *secretsManagerSource) Invalidate(name string) {
+	s.cache.Delete(name)
+	// Rotations of a secret which is not cached are not checked
+	s.versionsMu.Lock()
+	delete(s.versions, name)
+	s.versionsMu.Unlock()
+}
+
+func (s *secretsManagerSource) Keys(prefix string) []string {
+	return s.cache.KeysWithPrefix(prefix)
+}
+
+func (s *secretsManagerSource) Peek(name string) (CacheData, bool) {
+	return s.cache.Get(name)
+}
+
+func (s *secretsManagerSource) Stats() map[string]CacheStats {
+	return s.cache.StatsSnapshot()
+}
+
+// Return a single key of a JSON secret, strings are returned as is and other values as JSON
+func secretKeyValue(secret string, key string) (string, error) {
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &values); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object")
+	}
+
+	value, ok := values[key]
+	if !ok {
+		return "", fmt.Errorf("key does not exist")
+	}
+	if text, ok := value.(string); ok {
+		return text, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Read a secret from Secrets Manager
+func (s *secretsManagerSource) getSecretValue(config SecretsManagerConfiguration) (CacheData, bool, error) {
+	client, err := GetSecretsManagerClient(config.AwsConfiguration)
+	if err != nil {
+		return CacheData{}, false, err
+	}
+
+	input := &secretsmanager.GetSecretValueInput{SecretId: aws.String(config.SecretId)}
+	if config.VersionId != "" {
+		input.VersionId = aws.String(config.VersionId)
+	} else {
+		input.VersionStage = aws.String(config.VersionStage)
+	}
+
+	ctx, cancel := OriginContext()
+	defer cancel()
+	result, err := client.GetSecretValueWithContext(ctx, input)
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == secretsmanager.ErrCodeResourceNotFoundException {
+			println(PrintPrefix, "Could not find secret '"+config.SecretId+"'")
+			return CacheData{}, false, nil
+		}
+		return CacheData{}, false, err
+	}
+
+	s.versionsMu.Lock()
+	s.versions[config.SecretId] = aws.StringValue(result.VersionId)
+	s.versionsMu.Unlock()
+
+	data := CacheData{
+		Data:        aws.StringValue(result.SecretString),
+		CacheExpiry: GetCacheExpiryFor(config.ttl),
+		FetchedAt:   time.Now(),
+	}
+	if result.SecretString == nil {
+		data.Data = string(result.SecretBinary)
+		data.ContentType = "application/octet-stream"
+	}
+	return data, true, nil
+}
+
+// Periodically check whether the configured version stage moved to another version, for
+// example when rotation promotes AWSPENDING to AWSCURRENT, until stop is closed
+func (s *secretsManagerSource) watchRotation(config SecretsManagerConfiguration, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if err := s.checkRotation(config); err != nil {
+			println(PrintPrefix, fmt.Sprintf("Could not check rotation of secret '%s': %s", config.SecretId, err))
+		}
+	}
+}
+
+// Refresh a cached secret if its version stage points to a different version
+func (s *secretsManagerSource) checkRotation(config SecretsManagerConfiguration) error {
+	s.versionsMu.Lock()
+	cachedVersion, ok := s.versions[config.SecretId]
+	s.versionsMu.Unlock()
+	if !ok {
+		// Not cached yet, the next lookup reads the current version
+		return nil
+	}
+
+	client, err := GetSecretsManagerClient(config.AwsConfiguration)
+	if err != nil {
+		return err
+	}
+
+	// Checks go through the circuit breaker of lookups and count as its origin errors
+	var description *secretsmanager.DescribeSecretOutput
+	err = GetCircuitBreaker(SecretsManager).Call(func() error {
+		ctx, cancel := OriginContext()
+		defer cancel()
+		var err error
+		description, err = client.DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{
+			SecretId: aws.String(config.SecretId),
+		})
+		return err
+	})
+	if err != nil {
+		atomic.AddUint64(&s.cache.Stats(config.SecretId).OriginErrors, 1)
+		return err
+	}
+
+	currentVersion := ""
+	for versionId, stages := range description.VersionIdsToStages {
+		for _, stage := range stages {
+			if aws.StringValue(stage) == config.VersionStage {
+				currentVersion = versionId
+			}
+		}
+	}
+	if currentVersion == "" || currentVersion == cachedVersion {
+		return nil
+	}
+
+	println(PrintPrefix, fmt.Sprintf("Secret '%s' rotated to version %s, refreshing cache", config.SecretId, currentVersion))
+	_, err = s.cache.Fetch(config.SecretId, config.SecretId, SecretsManager, true, func(CacheData) (CacheData, bool, error) {
+		return s.getSecretValue(config)
+	})
+	return err
+}
+
+// Get the Secrets Manager client for a region, endpoint and role, created on first use
+func GetSecretsManagerClient(config AwsConfiguration) (secretsmanageriface.SecretsManagerAPI, error) {
+	return secretsManagerClients.get(config, config)
+}
@@ -0,0 +1,146 @@
+package plugins
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"gopkg.in/yaml.v2"
+)
+
+type fakeSecretsManagerClient struct {
+	secretsmanageriface.SecretsManagerAPI
+	current  string
+	versions map[string]string
+	binary   []byte
+	fail     bool
+}
+
+func (f *fakeSecretsManagerClient) GetSecretValueWithContext(_ aws.Context, input *secretsmanager.GetSecretValueInput, _ ...request.Option) (*secretsmanager.GetSecretValueOutput, error) {
+	if f.binary != nil {
+		return &secretsmanager.GetSecretValueOutput{VersionId: aws.String(f.current), SecretBinary: f.binary}, nil
+	}
+	return &secretsmanager.GetSecretValueOutput{
+		VersionId:    aws.String(f.current),
+		SecretString: aws.String(f.versions[f.current]),
+	}, nil
+}
+
+func (f *fakeSecretsManagerClient) DescribeSecretWithContext(aws.Context, *secretsmanager.DescribeSecretInput, ...request.Option) (*secretsmanager.DescribeSecretOutput, error) {
+	if f.fail {
+		return nil, awserr.NewRequestFailure(awserr.New(secretsmanager.ErrCodeInternalServiceError, "unavailable", nil), 500, "")
+	}
+	stages := map[string][]*string{}
+	for versionId := range f.versions {
+		stages[versionId] = []*string{aws.String("AWSPREVIOUS")}
+	}
+	stages[f.current] = []*string{aws.String("AWSCURRENT")}
+	return &secretsmanager.DescribeSecretOutput{VersionIdsToStages: stages}, nil
+}
+
+func TestSecretsManagerRotation(t *testing.T) {
+	client := &fakeSecretsManagerClient{current: "v1", versions: map[string]string{
+		"v1": `{"username":"app","password":"first","port":5432}`,
+		"v2": `{"username":"app","password":"second","port":5432}`,
+	}}
+	secretsManagerClients.set(AwsConfiguration{}, client)
+	defer secretsManagerClients.delete(AwsConfiguration{})
+
+	source := newSecretsManagerSource()
+	config := SecretsManagerConfiguration{SecretId: "prod/db", VersionStage: "AWSCURRENT"}
+	source.configs[config.SecretId] = config
+
+	request := CacheRequest{Name: "prod/db", Params: map[string]string{SecretKeyParam: "password"}}
+	if result, _ := source.Fetch(request); result.Data != "first" {
+		t.Errorf("Expected password of the first version. Got %+v", result)
+	}
+	if result, _ := source.Fetch(CacheRequest{Name: "prod/db", Params: map[string]string{SecretKeyParam: "port"}}); result.Data != "5432" {
+		t.Errorf("Expected port as JSON. Got %+v", result)
+	}
+
+	// Rotation promotes the pending version before the cache entry expires
+	client.current = "v2"
+	if err := source.checkRotation(config); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if result, _ := source.Fetch(request); result.Data != "second" {
+		t.Errorf("Expected password of the rotated version. Got %+v", result)
+	}
+
+	if _, err := source.Fetch(CacheRequest{Name: "other"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected unconfigured secret not to be found. Got %v", err)
+	}
+}
+
+func TestSecretsManagerReinit(t *testing.T) {
+	source := newSecretsManagerSource()
+	config := "- secretId: prod/db\n  rotationCheckInterval: 1h\n"
+	if err := source.Init(func(v interface{}) error { return yaml.Unmarshal([]byte(config), v) }); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	first := source.stopWatchers
+
+	if err := source.Init(func(v interface{}) error { return yaml.Unmarshal([]byte("- secretId: prod/api\n"), v) }); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	select {
+	case <-first:
+	default:
+		t.Error("Expected the watchers of the previous configuration to be stopped")
+	}
+	if _, ok := source.configs["prod/db"]; ok {
+		t.Error("Expected the previous configuration to be replaced")
+	}
+	close(source.stopWatchers)
+
+	source.versions["prod/api"] = "v1"
+	source.Invalidate("prod/api")
+	if _, ok := source.versions["prod/api"]; ok {
+		t.Error("Expected the version of an invalidated secret to be forgotten")
+	}
+}
+
+func TestSecretsManagerRotationFailure(t *testing.T) {
+	t.Setenv(CircuitBreakerThreshold, "1")
+	// The breaker is created again with the threshold
+	delete(circuitBreakers, SecretsManager)
+	defer delete(circuitBreakers, SecretsManager)
+	client := &fakeSecretsManagerClient{current: "v1", versions: map[string]string{"v1": "first"}}
+	secretsManagerClients.set(AwsConfiguration{}, client)
+	defer secretsManagerClients.delete(AwsConfiguration{})
+
+	source := newSecretsManagerSource()
+	config := SecretsManagerConfiguration{SecretId: "prod/db", VersionStage: "AWSCURRENT"}
+	source.configs[config.SecretId] = config
+	if _, err := source.Fetch(CacheRequest{Name: "prod/db"}); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	client.fail = true
+	if err := source.checkRotation(config); err == nil {
+		t.Fatal("Expected the rotation check to fail")
+	}
+	if stats := source.Stats()["prod/db"]; stats.OriginErrors != 1 {
+		t.Errorf("Expected the failed check to count as origin error. Got %+v", stats)
+	}
+	if !GetCircuitBreaker(SecretsManager).IsOpen() {
+		t.Error("Expected the failed check to open the circuit breaker")
+	}
+}
+
+func TestSecretsManagerBinarySecret(t *testing.T) {
+	client := &fakeSecretsManagerClient{current: "v1", binary: []byte{0x00, 0xff}}
+	secretsManagerClients.set(AwsConfiguration{}, client)
+	defer secretsManagerClients.delete(AwsConfiguration{})
+
+	source := newSecretsManagerSource()
+	source.configs["prod/key"] = SecretsManagerConfiguration{SecretId: "prod/key", VersionStage: "AWSCURRENT"}
+	result, err := source.Fetch(CacheRequest{Name: "prod/key"})
+	if err != nil || result.Data != "\x00\xff" || result.ContentType != "application/octet-stream" {
+		t.Errorf("Expected binary secret as application/octet-stream. Got %+v, %v", result, err)
+	}
+}
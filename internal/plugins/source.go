@@ -0,0 +1,151 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// Interface implemented by every cache source. A source is registered under its cache type,
+// which is both the name of its section in cache.yaml and the path it is served under
+type Source interface {
+	// Initialize the source with its section of cache.yaml
+	Init(unmarshal func(interface{}) error) error
+	// Load all configured data into the cache
+	Preload() error
+	// Read data from the cache, falling back to the origin when missing or expired. Errors wrap
+	// ErrNotFound, ErrInvalidRequest, ErrTooLarge, ErrOriginUnavailable or ErrOriginTimeout
+	Fetch(request CacheRequest) (CacheResult, error)
+	// Remove data from the cache
+	Invalidate(name string)
+	// Return the counters of the source, keyed by table, parameter or object
+	Stats() map[string]CacheStats
+}
+
+// Interface implemented by sources which can return several cached entries at once, such as the
+// items of a DynamoDB partition
+type QuerySource interface {
+	// Read the entries matching a request, each one as Fetch would read it
+	Query(request CacheRequest) ([]CacheResult, error)
+}
+
+// Interface implemented by sources whose cached entries can be listed and inspected without
+// calling the origin
+type InspectSource interface {
+	// Return the names of the cached entries starting with a prefix in alphabetical order
+	Keys(prefix string) []string
+	// Return a cached entry, expired or not, without loading it from the origin
+	Peek(name string) (CacheData, bool)
+}
+
+// Interface implemented by sources reporting the metadata of their entries to the admin API
+type AdminSource interface {
+	// Return the metadata of a cached entry without loading it from the origin
+	Entry(name string) (EntryInfo, bool)
+	// Return the number and size of the cached entries, keyed like Stats
+	Usage() map[string]CacheUsage
+}
+
+// Metadata of a cached entry
+type EntryInfo struct {
+	// Bytes of the name and data
+	Size        int
+	Tier        string
+	FetchedAt   time.Time
+	CacheExpiry time.Time
+	// Lookups served from the cache since the entry was loaded into memory
+	Hits uint64
+	// Configuration the entry is loaded from the origin with
+	Config map[string]string
+}
+
+// Number and size of the cached entries of a group
+type CacheUsage struct {
+	Entries int
+	Bytes   int
+}
+
+// Struct describing a lookup of a source
+type CacheRequest struct {
+	Name string
+	// Additional parameters of the lookup, for example the JSON key of a secret
+	Params map[string]string
+	// Skip cached data and load it from the origin, set by Cache-Control: no-cache
+	NoCache bool
+}
+
+// Errors returned by lookups
+var (
+	// The data does not exist or is not configured
+	ErrNotFound = errors.New("not found")
+	// The lookup is malformed, for example a key with missing parts
+	ErrInvalidRequest = errors.New("invalid request")
+	// The data exceeds the configured size limit and is not served, the origin is not at fault
+	ErrTooLarge = errors.New("too large")
+	// The origin failed and no stale copy could be served
+	ErrOriginUnavailable = errors.New("origin unavailable")
+	// The origin did not answer in time and no stale copy could be served
+	ErrOriginTimeout = errors.New("origin timed out")
+)
+
+var (
+	sources   = make(map[string]Source)
+	sourcesMu sync.RWMutex
+)
+
+// Register a source under its cache type, usually from the init function of its file
+func RegisterSource(cacheType string, source Source) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+
+	if _, ok := sources[cacheType]; ok {
+		panic("cache source " + cacheType + " is already registered")
+	}
+	sources[cacheType] = source
+}
+
+// Get the source registered under a cache type
+func GetSource(cacheType string) (Source, bool) {
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+
+	source, ok := sources[cacheType]
+	return source, ok
+}
+
+// Return the cache types of all registered sources in alphabetical order
+func SourceTypes() []string {
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+
+	cacheTypes := make([]string, 0, len(sources))
+	for cacheType := range sources {
+		cacheTypes = append(cacheTypes, cacheType)
+	}
+	sort.Strings(cacheTypes)
+	return cacheTypes
+}
+
+// Classify an error of an origin call as timeout or failure, keeping the original error
+func originError(err error) error {
+	if errors.Is(err, ErrOriginTimeout) || errors.Is(err, ErrOriginUnavailable) || errors.Is(err, ErrTooLarge) {
+		return err
+	}
+
+	timeout := errors.Is(err, context.DeadlineExceeded)
+	// The SDK reports an expired context as a canceled request
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.Code() == request.CanceledErrorCode {
+		timeout = true
+	}
+	if timeout {
+		return fmt.Errorf("%w: %w", ErrOriginTimeout, err)
+	}
+	return fmt.Errorf("%w: %w", ErrOriginUnavailable, err)
+}
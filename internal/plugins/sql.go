@@ -0,0 +1,324 @@
+package plugins
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+
+	// Drivers of the databases which can be configured
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+)
+
+// Cache type of SQL databases
+const Sql = "sql"
+
+// Placeholder of the password in a DSN, replaced by the password read from Secrets Manager
+const dsnPasswordPlaceholder = "{password}"
+
+// Struct to store the configuration of a SQL database and its named queries
+type SqlConfiguration struct {
+	Name              string                           `yaml:"name"`
+	Driver            string                           `yaml:"driver"`
+	Dsn               string                           `yaml:"dsn"`
+	PasswordSecretId  string                           `yaml:"passwordSecretId"`
+	PasswordSecretKey string                           `yaml:"passwordSecretKey"`
+	Ttl               string                           `yaml:"ttl"`
+	Queries           map[string]SqlQueryConfiguration `yaml:"queries"`
+
+	// Region, endpoint and credentials used to read the password secret
+	AwsConfiguration `yaml:",inline"`
+}
+
+// Struct to store a named query. Params name the request parameters bound to the placeholders
+// of the query in order
+type SqlQueryConfiguration struct {
+	Query  string   `yaml:"query"`
+	Params []string `yaml:"params"`
+	Ttl    string   `yaml:"ttl"`
+
+	ttl time.Duration
+}
+
+// Connection pool of a database, opened on first use
+type sqlDatabase struct {
+	config SqlConfiguration
+	mu     sync.Mutex
+	db     *sql.DB
+}
+
+// A named query and the database it runs on
+type sqlQuery struct {
+	SqlQueryConfiguration
+	database *sqlDatabase
+}
+
+// Source serving rows of named queries as JSON
+type sqlSource struct {
+	queries map[string]sqlQuery
+	cache   *cacheStore
+}
+
+// Returned when a request lacks a parameter of the query
+var errMissingQueryParam = errors.New("missing query parameter")
+
+func init() {
+	RegisterSource(Sql, &sqlSource{queries: make(map[string]sqlQuery), cache: newCacheStore()})
+}
+
+// Initialize the databases and queries listed in the sql section of cache.yaml
+func (s *sqlSource) Init(unmarshal func(interface{}) error) error {
+	var configs []SqlConfiguration
+	if err := unmarshal(&configs); err != nil {
+		return err
+	}
+
+	for _, config := range configs {
+		if config.Name == "" || config.Driver == "" || config.Dsn == "" {
+			return fmt.Errorf("name, driver and dsn are required for sql databases")
+		}
+		databaseTtl, err := ParseTtl(config.Ttl)
+		if err != nil {
+			return fmt.Errorf("sql database %s: %w", config.Name, err)
+		}
+
+		database := &sqlDatabase{config: config}
+		for name, query := range config.Queries {
+			if _, ok := s.queries[name]; ok {
+				return fmt.Errorf("sql query %s is configured more than once", name)
+			}
+			query.ttl, err = ParseTtl(query.Ttl)
+			if err != nil {
+				return fmt.Errorf("sql query %s: %w", name, err)
+			}
+			if query.ttl == 0 {
+				query.ttl = databaseTtl
+			}
+			s.queries[name] = sqlQuery{SqlQueryConfiguration: query, database: database}
+		}
+	}
+	return nil
+}
+
+// Run every query without parameters
+func (s *sqlSource) Preload() error {
+	var failed []string
+	for name, query := range s.queries {
+		if len(query.Params) > 0 {
+			continue
+		}
+		if _, err := s.Fetch(CacheRequest{Name: name}); err != nil {
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not run sql queries %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Fetch the rows of a named query as a JSON array, query parameters are taken from the request parameters
+func (s *sqlSource) Fetch(request CacheRequest) (CacheResult, error) {
+	query, ok := s.queries[request.Name]
+	if !ok {
+		return CacheResult{}, fmt.Errorf("%w: no sql configuration for query '%s'", ErrNotFound, request.Name)
+	}
+
+	args, err := queryArgs(query, request.Params)
+	if err != nil {
+		return CacheResult{}, fmt.Errorf("%w for sql query %s: %s", ErrInvalidRequest, request.Name, err)
+	}
+
+	key := sqlCacheKey(request.Name, query, request.Params)
+	return s.cache.Fetch(key, request.Name, Sql+":"+query.database.config.Name, request.NoCache, func(CacheData) (CacheData, bool, error) {
+		return query.run(args)
+	})
+}
+
+// Remove the result of a query, or of every parameter of it when given the query name
+func (s *sqlSource) Invalidate(name string) {
+	s.cache.DeleteWithParams(name)
+}
+
+func (s *sqlSource) Keys(prefix string) []string {
+	return s.cache.KeysWithPrefix(prefix)
+}
+
+func (s *sqlSource) Peek(name string) (CacheData, bool) {
+	return s.cache.Get(name)
+}
+
+func (s *sqlSource) Stats() map[string]CacheStats {
+	return s.cache.StatsSnapshot()
+}
+
+// Return the arguments of a query in the order of its params
+func queryArgs(query sqlQuery, params map[string]string) ([]interface{}, error) {
+	args := make([]interface{}, 0, len(query.Params))
+	for _, param := range query.Params {
+		value, ok := params[param]
+		if !ok {
+			return nil, fmt.Errorf("%w %s", errMissingQueryParam, param)
+		}
+		args = append(args, value)
+	}
+	return args, nil
+}
+
+// Key of a query result, "queryName?param=value&..." with the params of the query only
+func sqlCacheKey(name string, query sqlQuery, params map[string]string) string {
+	values := url.Values{}
+	for _, param := range query.Params {
+		values.Set(param, params[param])
+	}
+	if len(values) == 0 {
+		return name
+	}
+	return name + "?" + values.Encode()
+}
+
+// Run the query and convert its rows to a JSON array of objects
+func (q sqlQuery) run(args []interface{}) (CacheData, bool, error) {
+	db, err := q.database.open()
+	if err != nil {
+		return CacheData{}, false, err
+	}
+
+	ctx, cancel := OriginContext()
+	defer cancel()
+	rows, err := db.QueryContext(ctx, q.Query, args...)
+	if err != nil {
+		return CacheData{}, false, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return CacheData{}, false, err
+	}
+
+	result := make([]map[string]interface{}, 0)
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return CacheData{}, false, err
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			// Text columns are returned as bytes by most drivers
+			if value, ok := values[i].([]byte); ok {
+				row[column] = string(value)
+			} else {
+				row[column] = values[i]
+			}
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return CacheData{}, false, err
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return CacheData{}, false, err
+	}
+	return CacheData{
+		Data:        string(data),
+		CacheExpiry: GetCacheExpiryFor(q.ttl),
+		FetchedAt:   time.Now(),
+		ContentType: "application/json",
+	}, true, nil
+}
+
+// Open the connection pool of the database, reading the password from Secrets Manager if configured.
+// A failure is not kept so the next query tries again
+func (d *sqlDatabase) open() (*sql.DB, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.db != nil {
+		return d.db, nil
+	}
+
+	dsn := d.config.Dsn
+	if d.config.PasswordSecretId != "" {
+		password, err := d.readPassword()
+		if err != nil {
+			return nil, fmt.Errorf("could not read password of sql database %s: %w", d.config.Name, err)
+		}
+		dsn = strings.ReplaceAll(dsn, dsnPasswordPlaceholder, escapeDsnPassword(dsn, password))
+	}
+
+	db, err := sql.Open(d.config.Driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// A Lambda execution environment handles one invoke at a time
+	db.SetMaxOpenConns(2)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+	d.db = db
+	return db, nil
+}
+
+// Read the password of the database from Secrets Manager, either the whole secret or one of its
+// JSON keys ("password" by default)
+func (d *sqlDatabase) readPassword() (string, error) {
+	client, err := GetSecretsManagerClient(d.config.AwsConfiguration)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := OriginContext()
+	defer cancel()
+	result, err := client.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(d.config.PasswordSecretId),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return secretPassword(aws.StringValue(result.SecretString), d.config.PasswordSecretKey)
+}
+
+// Return the password of a secret, the given key or "password" of a JSON secret. Plain text
+// secrets hold the password only, unless a key is configured
+func secretPassword(secret string, key string) (string, error) {
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &values); err != nil {
+		if key != "" {
+			return "", fmt.Errorf("secret is not a JSON object with key '%s'", key)
+		}
+		return secret, nil
+	}
+
+	if key == "" {
+		key = "password"
+	}
+	password, err := secretKeyValue(secret, key)
+	if err != nil {
+		return "", fmt.Errorf("key '%s' of secret: %w", key, err)
+	}
+	return password, nil
+}
+
+// URL style DSNs need the password escaped as user info
+func escapeDsnPassword(dsn string, password string) string {
+	if !strings.Contains(dsn, "://") {
+		return password
+	}
+	return strings.TrimPrefix(url.UserPassword("", password).String(), ":")
+}
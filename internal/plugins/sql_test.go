@@ -0,0 +1,115 @@
+package plugins
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"gopkg.in/yaml.v2"
+)
+
+func TestSqlFetch(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "cache.db")
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE products (id TEXT, name TEXT, price INTEGER);
+		INSERT INTO products VALUES ('1', 'Book', 10), ('2', 'Pen', 2);`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	source := &sqlSource{queries: make(map[string]sqlQuery), cache: newCacheStore()}
+	config := `
+- name: catalog
+  driver: sqlite3
+  dsn: ` + dsn + `
+  ttl: 1m
+  queries:
+    products:
+      query: SELECT id, name, price FROM products ORDER BY id
+    product:
+      query: SELECT name, price FROM products WHERE id = ?
+      params: [id]
+`
+	if err := source.Init(func(v interface{}) error { return yaml.Unmarshal([]byte(config), v) }); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if err := source.Preload(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	result, err := source.Fetch(CacheRequest{Name: "products"})
+	if err != nil || result.Data != `[{"id":"1","name":"Book","price":10},{"id":"2","name":"Pen","price":2}]` || result.ContentType != "application/json" {
+		t.Fatalf("Expected all rows. Got %+v", result)
+	}
+
+	request := CacheRequest{Name: "product", Params: map[string]string{"id": "2", "other": "ignored"}}
+	if result, _ := source.Fetch(request); result.Data != `[{"name":"Pen","price":2}]` || result.Status != CacheMiss || result.Tier != TierOrigin {
+		t.Fatalf("Expected row of product 2 loaded from the database. Got %+v", result)
+	}
+
+	// Cached rows are served until they expire
+	if _, err := db.Exec(`UPDATE products SET price = 3 WHERE id = '2'`); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if result, _ := source.Fetch(request); result.Data != `[{"name":"Pen","price":2}]` || result.Status != CacheHit || result.Key != "product?id=2" {
+		t.Errorf("Expected cached row. Got %+v", result)
+	}
+	if _, ok := source.cache.Get("product?id=2"); !ok {
+		t.Errorf("Expected rows to be cached by query parameters. Got keys %v", source.cache.Keys())
+	}
+
+	request.NoCache = true
+	if result, _ := source.Fetch(request); result.Data != `[{"name":"Pen","price":3}]` || result.Status != CacheBypass {
+		t.Errorf("Expected lookup skipping the cache to read the database. Got %+v", result)
+	}
+
+	// Invalidating the query drops the rows of every parameter
+	source.Invalidate("product")
+	if keys := source.Keys("product"); len(keys) != 1 || keys[0] != "products" {
+		t.Errorf("Expected every result of the query to be invalidated. Got %v", keys)
+	}
+
+	if _, err := source.Fetch(CacheRequest{Name: "product"}); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("Expected lookup without query parameter to be invalid. Got %v", err)
+	}
+	if _, err := source.Fetch(CacheRequest{Name: "unknown"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected unknown query not to be found. Got %v", err)
+	}
+}
+
+func TestEscapeDsnPassword(t *testing.T) {
+	if password := escapeDsnPassword("postgres://app:{password}@db:5432/app", "p@ss/word"); password != "p%40ss%2Fword" {
+		t.Errorf("Expected escaped password. Got %s", password)
+	}
+	if password := escapeDsnPassword("app:{password}@tcp(db:3306)/app", "p@ss/word"); password != "p@ss/word" {
+		t.Errorf("Expected password as is. Got %s", password)
+	}
+}
+
+func TestSecretPassword(t *testing.T) {
+	tests := []struct {
+		secret   string
+		key      string
+		password string
+		valid    bool
+	}{
+		{`{"username":"app","password":"first"}`, "", "first", true},
+		{`{"username":"app","dbPassword":"second"}`, "dbPassword", "second", true},
+		{"plain", "", "plain", true},
+		{`{"username":"app"}`, "", "", false},
+		{`{"username":"app","password":"first"}`, "dbPassword", "", false},
+		{"plain", "dbPassword", "", false},
+	}
+	for _, test := range tests {
+		password, err := secretPassword(test.secret, test.key)
+		if (err == nil) != test.valid || password != test.password {
+			t.Errorf("%s with key '%s': expected %s. Got %s, %v", test.secret, test.key, test.password, password, err)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+// Cache type of SSM Parameter Store
+const Ssm = "ssm"
+
+// Struct to store SSM Parameter Store cache configuration. Either a single parameter is
+// configured by name or a hierarchy of parameters by path
+type SsmConfiguration struct {
+	Name           string `yaml:"name"`
+	Path           string `yaml:"path"`
+	Recursive      bool   `yaml:"recursive"`
+	WithDecryption *bool  `yaml:"withDecryption"`
+	Label          string `yaml:"label"`
+	Version        int64  `yaml:"version"`
+	Ttl            string `yaml:"ttl"`
+
+	// Region, endpoint and credentials used for these parameters
+	AwsConfiguration `yaml:",inline"`
+
+	ttl time.Duration
+}
+
+// Source serving parameters of SSM Parameter Store
+type ssmSource struct {
+	configs []SsmConfiguration
+	cache   *cacheStore
+}
+
+var (
+	ssmClients = newClientCache[AwsConfiguration](func(sess *session.Session, _ AwsConfiguration) ssmiface.SSMAPI {
+		return ssm.New(sess)
+	})
+)
+
+func init() {
+	RegisterSource(Ssm, &ssmSource{cache: newCacheStore()})
+}
+
+// Initialize the parameters listed in the ssm section of cache.yaml
+func (s *ssmSource) Init(unmarshal func(interface{}) error) error {
+	var configs []SsmConfiguration
+	if err := unmarshal(&configs); err != nil {
+		return err
+	}
+
+	for i := range configs {
+		config := &configs[i]
+		if (config.Name == "") == (config.Path == "") {
+			return fmt.Errorf("exactly one of name and path must be set for ssm parameters")
+		}
+		if config.Label != "" && config.Version != 0 {
+			return fmt.Errorf("only one of label and version can be set for ssm parameter %s", config.Name+config.Path)
+		}
+
+		ttl, err := ParseTtl(config.Ttl)
+		if err != nil {
+			return fmt.Errorf("ssm parameter %s: %w", config.Name+config.Path, err)
+		}
+		config.ttl = ttl
+	}
+
+	s.configs = configs
+	return nil
+}
+
+// Load every configured parameter and every parameter below the configured paths
+func (s *ssmSource) Preload() error {
+	var failed []string
+	for _, config := range s.configs {
+		if config.Name != "" {
+			if _, err := s.Fetch(CacheRequest{Name: config.Name}); err != nil {
+				failed = append(failed, config.Name)
+			}
+			continue
+		}
+
+		if err := s.loadPath(config); err != nil {
+			println(PrintPrefix, fmt.Sprintf("Error loading ssm parameters %s: %s", config.Path, err))
+			failed = append(failed, config.Path)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not load ssm parameters %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Fetch the value of a parameter, only configured parameters and parameters below configured paths are served
+func (s *ssmSource) Fetch(request CacheRequest) (CacheResult, error) {
+	name := request.Name
+	config, ok := s.configFor(name)
+	if !ok {
+		return CacheResult{}, fmt.Errorf("%w: no ssm configuration for parameter '%s'", ErrNotFound, name)
+	}
+
+	return s.cache.Fetch(name, config.Name+config.Path, Ssm, request.NoCache, func(CacheData) (CacheData, bool, error) {
+		return s.getParameter(config, name)
+	})
+}
+
+func (s *ssmSource) Invalidate(name string) {
+	s.cache.Delete(name)
+}
+
+func (s *ssmSource) Keys(prefix string) []string {
+	return s.cache.KeysWithPrefix(prefix)
+}
+
+func (s *ssmSource) Peek(name string) (CacheData, bool) {
+	return s.cache.Get(name)
+}
+
+func (s *ssmSource) Stats() map[string]CacheStats {
+	return s.cache.StatsSnapshot()
+}
+
+// Find the configuration of a parameter, an exact name wins over the longest matching path
+func (s *ssmSource) configFor(name string) (SsmConfiguration, bool) {
+	var match SsmConfiguration
+	found := false
+	for _, config := range s.configs {
+		if config.Name == name {
+			return config, true
+		}
+		if config.Path != "" && isBelowPath(name, config) && len(config.Path) > len(match.Path) {
+			match = config
+			found = true
+		}
+	}
+	return match, found
+}
+
+// Check whether a parameter is part of the hierarchy configured by path
+func isBelowPath(name string, config SsmConfiguration) bool {
+	path := strings.TrimSuffix(config.Path, "/") + "/"
+	if !strings.HasPrefix(name, path) {
+		return false
+	}
+	return config.Recursive || !strings.Contains(strings.TrimPrefix(name, path), "/")
+}
+
+// Read a single parameter from SSM Parameter Store
+func (s *ssmSource) getParameter(config SsmConfiguration, name string) (CacheData, bool, error) {
+	client, err := GetSsmClient(config.AwsConfiguration)
+	if err != nil {
+		return CacheData{}, false, err
+	}
+
+	// The label or version selector is appended to the parameter name
+	selector := name
+	if config.Label != "" {
+		selector += ":" + config.Label
+	} else if config.Version != 0 {
+		selector += fmt.Sprintf(":%d", config.Version)
+	}
+
+	ctx, cancel := OriginContext()
+	defer cancel()
+	result, err := client.GetParameterWithContext(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(selector),
+		WithDecryption: aws.Bool(withDecryption(config)),
+	})
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && (awsErr.Code() == ssm.ErrCodeParameterNotFound ||
+			awsErr.Code() == ssm.ErrCodeParameterVersionNotFound) {
+			println(PrintPrefix, "Could not find ssm parameter '"+selector+"'")
+			return CacheData{}, false, nil
+		}
+		return CacheData{}, false, err
+	}
+
+	return newParameterCacheData(config, result.Parameter), true, nil
+}
+
+// Read all parameters below a path from SSM Parameter Store and add them to the cache. Every page
+// is bound to the origin timeout
+func (s *ssmSource) loadPath(config SsmConfiguration) error {
+	// GetParametersByPath only reads the latest or labelled version, parameters of a pinned
+	// version are read on their first lookup
+	if config.Version != 0 {
+		return nil
+	}
+
+	client, err := GetSsmClient(config.AwsConfiguration)
+	if err != nil {
+		return err
+	}
+
+	input := &ssm.GetParametersByPathInput{
+		Path:           aws.String(config.Path),
+		Recursive:      aws.Bool(config.Recursive),
+		WithDecryption: aws.Bool(withDecryption(config)),
+	}
+	if config.Label != "" {
+		input.ParameterFilters = []*ssm.ParameterStringFilter{{
+			Key:    aws.String("Label"),
+			Option: aws.String("Equals"),
+			Values: []*string{aws.String(config.Label)},
+		}}
+	}
+
+	for {
+		ctx, cancel := OriginContext()
+		page, err := client.GetParametersByPathWithContext(ctx, input)
+		cancel()
+		if err != nil {
+			return err
+		}
+		for _, parameter := range page.Parameters {
+			s.cache.Set(aws.StringValue(parameter.Name), newParameterCacheData(config, parameter))
+		}
+		if aws.StringValue(page.NextToken) == "" {
+			return nil
+		}
+		input.NextToken = page.NextToken
+	}
+}
+
+// Build the cache data of a parameter
+func newParameterCacheData(config SsmConfiguration, parameter *ssm.Parameter) CacheData {
+	return CacheData{
+		Data:        aws.StringValue(parameter.Value),
+		CacheExpiry: GetCacheExpiryFor(config.ttl),
+		FetchedAt:   time.Now(),
+	}
+}
+
+// SecureString parameters are decrypted unless disabled explicitly
+func withDecryption(config SsmConfiguration) bool {
+	return config.WithDecryption == nil || *config.WithDecryption
+}
+
+// Get the SSM client for a region, endpoint and role, created on first use
+func GetSsmClient(config AwsConfiguration) (ssmiface.SSMAPI, error) {
+	return ssmClients.get(config, config)
+}
@@ -0,0 +1,139 @@
+package plugins
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"gopkg.in/yaml.v2"
+)
+
+type fakeSsmClient struct {
+	ssmiface.SSMAPI
+	parameters map[string]string
+	requested  []string
+}
+
+func (f *fakeSsmClient) GetParameterWithContext(_ aws.Context, input *ssm.GetParameterInput, _ ...request.Option) (*ssm.GetParameterOutput, error) {
+	name := aws.StringValue(input.Name)
+	f.requested = append(f.requested, name)
+	value, ok := f.parameters[name]
+	if !ok {
+		return nil, awserr.New(ssm.ErrCodeParameterNotFound, "not found", nil)
+	}
+	return &ssm.GetParameterOutput{Parameter: &ssm.Parameter{Name: input.Name, Value: aws.String(value)}}, nil
+}
+
+// Serves the parameters below a path one per page
+func (f *fakeSsmClient) GetParametersByPathWithContext(ctx aws.Context, input *ssm.GetParametersByPathInput, _ ...request.Option) (*ssm.GetParametersByPathOutput, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		return nil, errors.New("expected a deadline")
+	}
+	f.requested = append(f.requested, aws.StringValue(input.Path))
+	var names []string
+	for name := range f.parameters {
+		if strings.HasPrefix(name, aws.StringValue(input.Path)+"/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	start := 0
+	if input.NextToken != nil {
+		start, _ = strconv.Atoi(aws.StringValue(input.NextToken))
+	}
+	output := &ssm.GetParametersByPathOutput{}
+	if start < len(names) {
+		output.Parameters = []*ssm.Parameter{{Name: aws.String(names[start]), Value: aws.String(f.parameters[names[start]])}}
+	}
+	if start+1 < len(names) {
+		output.NextToken = aws.String(strconv.Itoa(start + 1))
+	}
+	return output, nil
+}
+
+func newTestSsmSource(t *testing.T, config string, client *fakeSsmClient) *ssmSource {
+	ssmClients.set(AwsConfiguration{}, client)
+	t.Cleanup(func() { ssmClients.delete(AwsConfiguration{}) })
+
+	source := &ssmSource{cache: newCacheStore()}
+	err := source.Init(func(v interface{}) error { return yaml.Unmarshal([]byte(config), v) })
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	return source
+}
+
+func TestSsmFetch(t *testing.T) {
+	client := &fakeSsmClient{parameters: map[string]string{
+		"/app/db/host:prod": "db.internal",
+		"/app/flags/beta":   "on",
+	}}
+	source := newTestSsmSource(t, `
+- name: /app/db/host
+  label: prod
+- path: /app/flags
+`, client)
+
+	if result, _ := source.Fetch(CacheRequest{Name: "/app/db/host"}); result.Data != "db.internal" {
+		t.Errorf("Expected labelled parameter value. Got %+v", result)
+	}
+	if result, _ := source.Fetch(CacheRequest{Name: "/app/flags/beta"}); result.Data != "on" {
+		t.Errorf("Expected parameter below path. Got %+v", result)
+	}
+	if _, err := source.Fetch(CacheRequest{Name: "/app/flags/nested/beta"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected nested parameter of a non recursive path not to be found. Got %v", err)
+	}
+	if _, err := source.Fetch(CacheRequest{Name: "/other"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected unconfigured parameter not to be found. Got %v", err)
+	}
+
+	// Served from the cache without calling SSM again
+	calls := len(client.requested)
+	source.Fetch(CacheRequest{Name: "/app/db/host"})
+	if len(client.requested) != calls {
+		t.Error("Expected cached parameter to be served from the cache")
+	}
+}
+
+func TestSsmPreloadPath(t *testing.T) {
+	client := &fakeSsmClient{parameters: map[string]string{
+		"/app/flags/a":  "1",
+		"/app/flags/b":  "2",
+		"/app/pinned/c": "3",
+	}}
+	source := newTestSsmSource(t, `
+- path: /app/flags
+- path: /app/pinned
+  version: 2
+`, client)
+
+	if err := source.Preload(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for name, value := range map[string]string{"/app/flags/a": "1", "/app/flags/b": "2"} {
+		if cached, ok := source.Peek(name); !ok || cached.Data != value {
+			t.Errorf("Expected %s to be loaded from every page. Got %+v", name, cached)
+		}
+	}
+	if _, ok := source.Peek("/app/pinned/c"); ok {
+		t.Error("Expected parameters of a pinned version not to be loaded by path")
+	}
+}
+
+func TestSsmInitValidation(t *testing.T) {
+	source := &ssmSource{cache: newCacheStore()}
+	err := source.Init(func(v interface{}) error {
+		return yaml.Unmarshal([]byte("- name: /a\n  path: /b\n"), v)
+	})
+	if err == nil {
+		t.Error("Expected an error when both name and path are set")
+	}
+}
@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"time"
 )
 
-// Lambda environment variable for defining TTL
+// Lambda environment variables for defining TTL and how long expired data may be served on errors
 const (
 	CacheTimeOut = "CACHE_EXTENSION_TTL"
+	MaxStaleness = "CACHE_EXTENSION_MAX_STALENESS"
 )
 
 var (
@@ -22,6 +24,86 @@ var (
 type CacheData struct {
 	Data        string
 	CacheExpiry time.Time
+	FetchedAt   time.Time
+	// Time after which the data must never be served, not even as stale data. Zero if unbounded
+	HardExpiry time.Time
+	// Media type of the data, empty if unknown
+	ContentType string
+	// Validators of the origin used for conditional refreshes
+	OriginETag         string
+	OriginLastModified string
+	// Served to the lookup which loaded the data but never cached
+	NoStore bool
+}
+
+// How a lookup was answered, reported in the X-Cache response header
+type CacheStatus string
+
+const (
+	// Fresh data served from the cache
+	CacheHit CacheStatus = "HIT"
+	// Data loaded from the origin because it was missing or expired
+	CacheMiss CacheStatus = "MISS"
+	// Expired data served because the origin is unavailable
+	CacheStale CacheStatus = "STALE"
+	// Data loaded from the origin because the lookup asked to skip the cache
+	CacheBypass CacheStatus = "BYPASS"
+)
+
+// Tiers the data of a lookup may come from, reported in the X-Cache-Tier response header
+const (
+	TierMemory = "memory"
+	TierDisk   = "disk"
+	TierShared = "shared"
+	TierOrigin = "origin"
+)
+
+// Struct returned for a cache lookup
+type CacheResult struct {
+	Data string
+	// Media type of the data, empty if the source does not know it
+	ContentType string
+	Status      CacheStatus
+	Tier        string
+	// Key the data is cached under
+	Key         string
+	FetchedAt   time.Time
+	CacheExpiry time.Time
+}
+
+// Counters of a cache
+type CacheStats struct {
+	// Lookups served from the cache and lookups loaded from the origin
+	Hits         uint64
+	Misses       uint64
+	OriginErrors uint64
+	StaleServed  uint64
+	// Entries evicted from memory because of CACHE_EXTENSION_MEMORY_MAX_BYTES
+	Evictions uint64
+}
+
+// Return a consistent copy of the counters
+func (s *CacheStats) Snapshot() CacheStats {
+	return CacheStats{
+		Hits:         atomic.LoadUint64(&s.Hits),
+		Misses:       atomic.LoadUint64(&s.Misses),
+		OriginErrors: atomic.LoadUint64(&s.OriginErrors),
+		StaleServed:  atomic.LoadUint64(&s.StaleServed),
+		Evictions:    atomic.LoadUint64(&s.Evictions),
+	}
+}
+
+// Build the result of a lookup served from this data
+func (d CacheData) Result(key string, status CacheStatus, tier string) CacheResult {
+	return CacheResult{
+		Data:        d.Data,
+		ContentType: d.ContentType,
+		Status:      status,
+		Tier:        tier,
+		Key:         key,
+		FetchedAt:   d.FetchedAt,
+		CacheExpiry: d.CacheExpiry,
+	}
 }
 
 // Check whether cache has expired
@@ -29,6 +111,17 @@ func IsExpired(cacheExpiry time.Time) bool {
 	return cacheExpiry.Before(time.Now())
 }
 
+// Check whether expired cache data may still be served because the origin is unavailable
+func CanServeStale(data CacheData) bool {
+	if data.Data == "" {
+		return false
+	}
+	if !data.HardExpiry.IsZero() && IsExpired(data.HardExpiry) {
+		return false
+	}
+	return time.Since(data.CacheExpiry) <= getDurationEnv(MaxStaleness, 10*time.Minute)
+}
+
 // Return cache expiry timestamp based on "time.Now() + CACHE_EXTENSION_TTL"
 func GetCacheExpiry() time.Time {
 	// Refresh cache is required via environment variable
@@ -45,6 +138,26 @@ func GetCacheExpiry() time.Time {
 	return time.Now().Add(timeOutInMinutes)
 }
 
+// Return cache expiry timestamp based on a TTL configured for the data, falling back to CACHE_EXTENSION_TTL
+func GetCacheExpiryFor(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return GetCacheExpiry()
+	}
+	return time.Now().Add(ttl)
+}
+
+// Parse a TTL configured in cache.yaml, an empty value means CACHE_EXTENSION_TTL is used
+func ParseTtl(ttl string) (time.Duration, error) {
+	if ttl == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(ttl)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ttl '%s': %w", ttl, err)
+	}
+	return duration, nil
+}
+
 // Method for pretty printing objects in logs
 func PrettyPrint(v interface{}) string {
 	data, err := json.MarshalIndent(v, "", "\t")
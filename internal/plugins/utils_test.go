@@ -0,0 +1,25 @@
+package plugins
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCanServeStale(t *testing.T) {
+	t.Setenv(MaxStaleness, "1m")
+
+	data := CacheData{Data: "{}", CacheExpiry: time.Now().Add(-30 * time.Second)}
+	if !CanServeStale(data) {
+		t.Error("Expected data expired within the maximum staleness to be served")
+	}
+
+	data.CacheExpiry = time.Now().Add(-2 * time.Minute)
+	if CanServeStale(data) {
+		t.Error("Expected data expired beyond the maximum staleness not to be served")
+	}
+
+	data = CacheData{Data: "{}", CacheExpiry: time.Now().Add(-time.Second), HardExpiry: time.Now().Add(-time.Second)}
+	if CanServeStale(data) {
+		t.Error("Expected data past its item TTL never to be served")
+	}
+}
@@ -0,0 +1,175 @@
+package plugins
+
+import (
+	"sync"
+	"time"
+)
+
+// Lambda environment variable for how long lookups wait for the warmup of their table instead of
+// reading the origin, e.g. 2s. Lookups do not wait by default
+const WarmupWait = "CACHE_EXTENSION_WARMUP_WAIT"
+
+// State of loading the data of a source or table before the first lookup
+type WarmState string
+
+const (
+	// Not initialized yet
+	WarmPending WarmState = "pending"
+	WarmLoading WarmState = "loading"
+	WarmReady   WarmState = "ready"
+	WarmFailed  WarmState = "failed"
+	// Not preloaded, entries are loaded on their first lookup
+	WarmLazy WarmState = "lazy"
+)
+
+// Warmup of a group of a source, e.g. a Dynamodb table
+type WarmStatus struct {
+	State WarmState
+	// Entries currently cached
+	Items    int
+	LoadedAt time.Time
+	// Last error of the warmup or of reading the origin afterwards
+	LastError   string
+	LastErrorAt time.Time
+}
+
+// Source reporting the warmup of its groups
+type WarmupSource interface {
+	Warmup() map[string]WarmStatus
+	// Report the groups as loaded on their first lookup, called when the source is not preloaded
+	SkipWarmup()
+}
+
+// Tracks the warmup of the groups of a source so lookups can wait for it
+type warmupTracker struct {
+	mu     sync.Mutex
+	groups map[string]*warmupGroup
+}
+
+type warmupGroup struct {
+	status WarmStatus
+	// Closed once the warmup finished
+	done chan struct{}
+}
+
+func newWarmupTracker() *warmupTracker {
+	return &warmupTracker{groups: make(map[string]*warmupGroup)}
+}
+
+// Get a group, created lazy on first use. The caller holds mu
+func (w *warmupTracker) group(name string) *warmupGroup {
+	group, ok := w.groups[name]
+	if !ok {
+		group = &warmupGroup{status: WarmStatus{State: WarmLazy}, done: make(chan struct{})}
+		close(group.done)
+		w.groups[name] = group
+	}
+	return group
+}
+
+// Mark a group as loading, lookups of it wait until finish is called
+func (w *warmupTracker) start(name string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	group := w.group(name)
+	if group.status.State != WarmLoading {
+		group.status.State = WarmLoading
+		group.done = make(chan struct{})
+	}
+}
+
+// Mark the groups as loading and forget any other group, lookups waiting for it stop waiting
+func (w *warmupTracker) reset(names []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, group := range w.groups {
+		select {
+		case <-group.done:
+		default:
+			close(group.done)
+		}
+	}
+	w.groups = make(map[string]*warmupGroup, len(names))
+	for _, name := range names {
+		w.groups[name] = &warmupGroup{status: WarmStatus{State: WarmLoading}, done: make(chan struct{})}
+	}
+}
+
+// Mark the groups still loading as lazy, they are loaded on their first lookup
+func (w *warmupTracker) skip() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, group := range w.groups {
+		if group.status.State == WarmLoading {
+			group.status.State = WarmLazy
+			close(group.done)
+		}
+	}
+}
+
+// Mark a group as ready, or failed with an error
+func (w *warmupTracker) finish(name string, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	group := w.group(name)
+	if err != nil {
+		group.status.State = WarmFailed
+		group.status.LastError = err.Error()
+		group.status.LastErrorAt = time.Now()
+	} else {
+		group.status.State = WarmReady
+		group.status.LoadedAt = time.Now()
+	}
+	select {
+	case <-group.done:
+	default:
+		close(group.done)
+	}
+}
+
+// Record a failed read of the origin after the warmup
+func (w *warmupTracker) recordError(name string, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	group := w.group(name)
+	group.status.LastError = err.Error()
+	group.status.LastErrorAt = time.Now()
+}
+
+// Wait up to CACHE_EXTENSION_WARMUP_WAIT for the warmup of a group, true if the lookup waited
+func (w *warmupTracker) wait(name string) bool {
+	timeout := getDurationEnv(WarmupWait, 0)
+	if timeout <= 0 {
+		return false
+	}
+
+	w.mu.Lock()
+	group, ok := w.groups[name]
+	loading := ok && group.status.State == WarmLoading
+	var done chan struct{}
+	if loading {
+		done = group.done
+	}
+	w.mu.Unlock()
+	if !loading {
+		return false
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+	}
+	return true
+}
+
+// Return the status of a group, lazy if its warmup never started
+func (w *warmupTracker) status(name string) WarmStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if group, ok := w.groups[name]; ok {
+		return group.status
+	}
+	return WarmStatus{State: WarmLazy}
+}
@@ -0,0 +1,74 @@
+package plugins
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWarmupTracker(t *testing.T) {
+	tracker := newWarmupTracker()
+	if tracker.wait("table") || tracker.status("table").State != WarmLazy {
+		t.Error("Expected a table without warmup to be lazy")
+	}
+
+	tracker.start("table")
+	if tracker.wait("table") {
+		t.Error("Expected lookups not to wait without " + WarmupWait)
+	}
+
+	t.Setenv(WarmupWait, "5s")
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		tracker.finish("table", nil)
+	}()
+	start := time.Now()
+	if !tracker.wait("table") || time.Since(start) > 2*time.Second {
+		t.Errorf("Expected the lookup to wait until the warmup finished. Waited %s", time.Since(start))
+	}
+	if status := tracker.status("table"); status.State != WarmReady || status.LoadedAt.IsZero() {
+		t.Errorf("Expected the table to be ready. Got %+v", status)
+	}
+	if tracker.wait("table") {
+		t.Error("Expected lookups of a ready table not to wait")
+	}
+
+	t.Setenv(WarmupWait, "10ms")
+	tracker.start("other")
+	if !tracker.wait("other") {
+		t.Error("Expected the lookup to wait until the timeout")
+	}
+	tracker.finish("other", errors.New("scan failed"))
+	tracker.recordError("table", errors.New("throttled"))
+	if status := tracker.status("other"); status.State != WarmFailed || status.LastError != "scan failed" {
+		t.Errorf("Expected the warmup to fail. Got %+v", status)
+	}
+	if status := tracker.status("table"); status.State != WarmReady || status.LastError != "throttled" || status.LastErrorAt.IsZero() {
+		t.Errorf("Expected the error to be recorded without changing the state. Got %+v", status)
+	}
+}
+
+func TestWarmupTrackerReset(t *testing.T) {
+	tracker := newWarmupTracker()
+	tracker.start("removed")
+	tracker.reset([]string{"customers", "orders"})
+	if status := tracker.status("customers"); status.State != WarmLoading {
+		t.Errorf("Expected the table to be loading. Got %+v", status)
+	}
+	if status := tracker.status("removed"); status.State != WarmLazy {
+		t.Errorf("Expected a table no longer configured to be forgotten. Got %+v", status)
+	}
+
+	tracker.finish("orders", nil)
+	tracker.skip()
+	if status := tracker.status("customers"); status.State != WarmLazy {
+		t.Errorf("Expected a table which is not preloaded to be lazy. Got %+v", status)
+	}
+	if status := tracker.status("orders"); status.State != WarmReady {
+		t.Errorf("Expected a loaded table to stay ready. Got %+v", status)
+	}
+	t.Setenv(WarmupWait, "5s")
+	if tracker.wait("customers") {
+		t.Error("Expected lookups of a lazy table not to wait")
+	}
+}
@@ -6,11 +6,11 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/alecthomas/kingpin/v2"
 	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/extension"
 	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/ipc"
 	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/plugins"
 	"github.com/nthienan/aws-dynamodb-cache-lambda-extension/internal/version"
-    "github.com/alecthomas/kingpin/v2"
 )
 
 var (
@@ -18,11 +18,31 @@ var (
 )
 
 func main() {
-    kingpin.Version(version.Print("aws-dynamodb-cache-lambda-extension"))
+	kingpin.Version(version.Print("aws-dynamodb-cache-lambda-extension"))
 
-    // parse flags
+	// The extension runs by default, the snapshot command is used when building the function
+	kingpin.Command("run", "Run as Lambda extension.").Default()
+	snapshotCmd := kingpin.Command("snapshot", "Scan the DynamoDB tables of cache.yaml and write a snapshot to deploy with the function.")
+	snapshotConfig := snapshotCmd.Flag("config", "Path of cache.yaml.").Default(extension.FileName).String()
+	snapshotOutput := snapshotCmd.Flag("output", "Path of the snapshot file, deploy it as "+plugins.DefaultSnapshotFile+".").
+		Short('o').Default("cache.snapshot").String()
+
+	// Addresses of the local servers, given by flag, env variable or the server section of cache.yaml
+	listenAddress := kingpin.Flag("listen-address", "Address of the HTTP server, host:port or unix:<path>.").
+		Envar(ipc.ListenAddress).String()
+	grpcAddress := kingpin.Flag("grpc-address", "Address of the gRPC server, host:port, unix:<path> or off.").
+		Envar(ipc.GrpcAddress).String()
+	respAddress := kingpin.Flag("resp-address", "Address of the Redis protocol listener, host:port or unix:<path>.").
+		Envar(ipc.RespAddress).String()
+
+	// parse flags
 	kingpin.HelpFlag.Short('h')
-	kingpin.Parse()
+	if kingpin.Parse() == snapshotCmd.FullCommand() {
+		if err := extension.WriteSnapshotFile(*snapshotConfig, *snapshotOutput); err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		return
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -40,11 +60,24 @@ func main() {
 		panic(err)
 	}
 
-	// Initialize all the cache plugins
+	// Bind the servers before loading the cache, failing right away if an address cannot be bound
+	extension.LoadCacheConfig()
+	serverConfig := extension.GetServerConfiguration()
+	servers, err := ipc.Bind(ipc.Addresses{
+		Http: firstNonEmpty(*listenAddress, serverConfig.ListenAddress, ipc.DefaultListenAddress),
+		Grpc: firstNonEmpty(*grpcAddress, serverConfig.GrpcAddress, ipc.DefaultGrpcAddress),
+		Resp: firstNonEmpty(*respAddress, serverConfig.RespAddress),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	// Initialize all the cache plugins before serving lookups, which read their configuration
 	extension.InitCacheExtensions()
+	servers.Serve()
 
-	// Start HTTP server
-	ipc.Start("4000")
+	// Load the cache while serving, lookups may wait for the tables still loading
+	extension.PreloadCacheExtensions()
 
 	// Will block until shutdown event is received or cancelled via the context.
 	processEvents(ctx)
@@ -64,12 +97,29 @@ func processEvents(ctx context.Context) {
 				return
 			}
 
+			// Bound origin calls by the deadline of the current invoke
+			if res.EventType == extension.Invoke {
+				plugins.SetInvokeDeadline(res.DeadlineMs)
+			}
+
 			// Exit if we receive a SHUTDOWN event
 			if res.EventType == extension.Shutdown {
 				println(plugins.PrintPrefix, "Received SHUTDOWN event")
+				plugins.ExportSnapshotsOnShutdown(res.DeadlineMs)
+				plugins.CloseDiskCache()
 				println(plugins.PrintPrefix, "Exiting")
 				return
 			}
 		}
 	}
 }
+
+// Return the first value which is set
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}